@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/rocketmq"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+const (
+	replayToTopic    = "topic"
+	replayToCallback = "callback"
+)
+
+func dlqCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "dlq",
+		Short:   "inspect, replay and purge dead letters of a consumer group",
+		Example: dlqExample,
+	}
+	cmd.PersistentFlags().StringP("instance", "i", "", "rocketMQ instance, default instance if empty")
+	cmd.PersistentFlags().StringP("group", "g", "", "consumer groupID")
+	cmd.PersistentFlags().Duration("timeout", 10*time.Second, "timeout of each broker request")
+	_ = cmd.MarkPersistentFlagRequired("group")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list dead letters not purged yet",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, q, err := newDeadLetter(cmd, "")
+			if err != nil {
+				return err
+			}
+			filter, err := dlqFilter(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := q.context()
+			defer cancel()
+
+			views, err := d.List(ctx, q.instance, q.group, filter)
+			if err != nil {
+				return err
+			}
+			return printJSON(views)
+		},
+	}
+	addFilterFlags(list)
+
+	show := &cobra.Command{
+		Use:   "show <msgId>",
+		Short: "show a dead letter by msgId",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, q, err := newDeadLetter(cmd, "")
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := q.context()
+			defer cancel()
+
+			view, err := d.Show(ctx, q.instance, q.group, args[0])
+			if err != nil {
+				return err
+			}
+			return printJSON(view)
+		},
+	}
+
+	replay := &cobra.Command{
+		Use:   "replay [msgId...]",
+		Short: "replay dead letters to the original topic or the consumer's callbackURL",
+		Long: `replay dead letters given by msgId, or all dead letters matching the filters.
+replayed messages stay in the dead letter topic, purge them afterwards if needed.`,
+		RunE: runReplay,
+	}
+	addFilterFlags(replay)
+	replay.Flags().String("to", replayToTopic, `replay target, "topic" resends to the original topic and reaches every group subscribing it, "callback" calls this group's callbackURL only`)
+	replay.Flags().Float64("rate", 10, "max messages replayed per second")
+	replay.Flags().Bool("dry-run", false, "print the messages to replay without replaying")
+
+	purge := &cobra.Command{
+		Use:   "purge",
+		Short: "purge dead letters stored before a time",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, q, err := newDeadLetter(cmd, "")
+			if err != nil {
+				return err
+			}
+			before, err := parseTime(cmd, "before")
+			if err != nil {
+				return err
+			}
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			ctx, cancel := q.context()
+			defer cancel()
+
+			n, err := d.Purge(ctx, q.instance, q.group, before, dryRun)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Printf("%d dead letters of %s would be purged\n", n, q.group)
+				return nil
+			}
+			fmt.Printf("%d dead letters of %s purged\n", n, q.group)
+			return nil
+		},
+	}
+	purge.Flags().String("before", "", `purge dead letters stored before this time, "`+timeLayout+`" or a duration ago, all if empty`)
+	purge.Flags().Bool("dry-run", false, "count the dead letters to purge without purging")
+
+	cmd.AddCommand(list, show, replay, purge)
+	return cmd
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	to, _ := cmd.Flags().GetString("to")
+	if to != replayToTopic && to != replayToCallback {
+		return errors.Errorf(`invalid --to %q, want "%s" or "%s"`, to, replayToTopic, replayToCallback)
+	}
+	rate, _ := cmd.Flags().GetFloat64("rate")
+	if rate <= 0 {
+		return errors.Errorf("invalid --rate %v, must be positive", rate)
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	target := to
+	if dryRun {
+		target = ""
+	}
+	d, q, err := newDeadLetter(cmd, target)
+	if err != nil {
+		return err
+	}
+	defer q.cleanup()
+
+	views, err := replayViews(cmd, d, q, args)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("%d dead letters of %s would be replayed to %s\n", len(views), q.group, to)
+		return printJSON(views)
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	var failed int
+	for i, view := range views {
+		if i > 0 {
+			<-ticker.C
+		}
+
+		ctx, cancel := q.context()
+		if to == replayToTopic {
+			var res *primitive.SendResult
+			if res, err = d.Redrive(ctx, q.instance, view); err == nil {
+				fmt.Printf("replayed %s to topic, new msgId %s\n", view.MsgID, res.MsgID)
+			}
+		} else {
+			err = d.Deliver(ctx, q.instance, q.group, view)
+			if err == nil {
+				fmt.Printf("replayed %s to callback\n", view.MsgID)
+			}
+		}
+		cancel()
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "replay %s failed: %v\n", view.MsgID, err)
+		}
+	}
+
+	fmt.Printf("%d dead letters of %s replayed, %d failed\n", len(views)-failed, q.group, failed)
+	if failed > 0 {
+		return errors.Errorf("%d dead letters failed to replay", failed)
+	}
+	return nil
+}
+
+// replayViews 返回 msgId 指定的死信, 未指定时返回匹配过滤条件的死信.
+func replayViews(cmd *cobra.Command, d *rocketmq.DeadLetter, q dlqFlags, msgIDs []string) ([]*rocketmq.MessageView, error) {
+	if len(msgIDs) == 0 {
+		filter, err := dlqFilter(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := q.context()
+		defer cancel()
+		return d.List(ctx, q.instance, q.group, filter)
+	}
+
+	views := make([]*rocketmq.MessageView, 0, len(msgIDs))
+	for _, id := range msgIDs {
+		ctx, cancel := q.context()
+		view, err := d.Show(ctx, q.instance, q.group, id)
+		cancel()
+		if err != nil {
+			return nil, errors.Wrapf(err, "dead letter %s", id)
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+type dlqFlags struct {
+	instance string
+	group    string
+	timeout  time.Duration
+	cleanup  func()
+}
+
+func (q dlqFlags) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), q.timeout)
+}
+
+// newDeadLetter target 为 replayToTopic 时启动 producer, 为 replayToCallback 时创建回调用的 consumer.
+func newDeadLetter(cmd *cobra.Command, target string) (*rocketmq.DeadLetter, dlqFlags, error) {
+	q := dlqFlags{cleanup: func() {}}
+	q.instance, _ = cmd.Flags().GetString("instance")
+	q.group, _ = cmd.Flags().GetString("group")
+	q.timeout, _ = cmd.Flags().GetDuration("timeout")
+
+	conf, err := loadConfig(cmd)
+	if err != nil {
+		return nil, q, err
+	}
+
+	var (
+		producer *rocketmq.Producer
+		consumer *rocketmq.Consumer
+	)
+	switch target {
+	case replayToTopic:
+		producer, q.cleanup, err = rocketmq.NewProducer(conf)
+		if err != nil {
+			return nil, q, err
+		}
+	case replayToCallback:
+		consumer, q.cleanup = rocketmq.NewConsumer(conf, rocketmq.NewCallback(), nil)
+	}
+
+	return rocketmq.NewDeadLetter(conf, rocketmq.NewAdmin(conf), producer, consumer), q, nil
+}
+
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("begin", "", `stored after this time, "`+timeLayout+`" or a duration ago`)
+	cmd.Flags().String("end", "", `stored before this time, "`+timeLayout+`" or a duration ago`)
+	cmd.Flags().String("tag", "", "message tag")
+	cmd.Flags().String("key", "", "message key")
+	cmd.Flags().Int("max", 64, "max messages")
+}
+
+func dlqFilter(cmd *cobra.Command) (rocketmq.DeadLetterFilter, error) {
+	filter := rocketmq.DeadLetterFilter{}
+
+	var err error
+	if filter.Begin, err = parseTime(cmd, "begin"); err != nil {
+		return filter, err
+	}
+	if filter.End, err = parseTime(cmd, "end"); err != nil {
+		return filter, err
+	}
+	filter.Tag, _ = cmd.Flags().GetString("tag")
+	filter.Key, _ = cmd.Flags().GetString("key")
+	filter.Max, _ = cmd.Flags().GetInt("max")
+	return filter, nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+const dlqExample = `app dlq list -g GID_for_consumer --begin 24h --tag tagA
+app dlq show 7F00000100002A9F0000000000000001 -g GID_for_consumer
+app dlq replay -g GID_for_consumer --key order-123 --dry-run
+app dlq replay -g GID_for_consumer --to callback --rate 5 7F00000100002A9F0000000000000001
+app dlq purge -g GID_for_consumer --before 72h`
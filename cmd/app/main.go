@@ -5,8 +5,11 @@ import (
 	"github.com/linhoi/mq/external/log"
 	"github.com/linhoi/mq/inject"
 	"github.com/linhoi/mq/internal/config"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -17,7 +20,7 @@ func main() {
 	}
 	root.PersistentFlags().StringP("env", "e", "env.yaml", "config file")
 
-	root.AddCommand(starCmd())
+	root.AddCommand(starCmd(), queryCmd(), dlqCmd(), offsetsCmd())
 
 	if err := root.Execute(); err != nil {
 		os.Exit(1)
@@ -38,19 +41,61 @@ func start(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
-	env := config.Env(envPath)
-	app, cleanup, err := inject.InitApp(env)
+	// 在启动 producer 与消费组之前检查.
+	if err = checkOffsetStoreDir(config.New(config.Env(envPath), nil).RocketMQ.OffsetStoreDir); err != nil {
+		return err
+	}
+
+	app, cleanup, err := inject.InitApp(config.Env(envPath))
 	if err != nil {
 		return err
 	}
 	defer cleanup()
 	log.S(context.Background()).Infof("app %s start", app.Conf.App.Name)
 
-	err = app.GRPCServer.Start()
+	// 所有消费组启动成功后才开始监听, 避免未就绪时对外提供服务.
+	if err = app.Consumer.Start(); err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- app.GRPCServer.Start()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err = <-serveErr:
+	case sig := <-quit:
+		log.S(context.Background()).Infof("app %s receive signal %s, shutting down", app.Conf.App.Name, sig)
+		app.GRPCServer.Stop()
+		err = <-serveErr
+	}
+
+	app.Consumer.Shutdown()
+	log.S(context.Background()).Infof("app %s stopped", app.Conf.App.Name)
 	return err
+}
 
+// rocketmq-client-go 在包初始化时读取广播模式的本地位点目录, 只能在启动进程前通过环境变量设置.
+const offsetStoreDirEnv = "rocketmq.client.localOffsetStoreDir"
+
+// checkOffsetStoreDir 配置的目录与环境变量不一致时启动失败, 避免位点写到其他目录.
+func checkOffsetStoreDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if got := os.Getenv(offsetStoreDirEnv); got != dir {
+		return errors.Errorf("rocketMQ.offsetStoreDir is %q but env %s is %q, start the app with: env %s=%s app start",
+			dir, offsetStoreDirEnv, got, offsetStoreDirEnv, dir)
+	}
+	return os.MkdirAll(dir, 0755)
 }
 
 const example = `go run cmd/main.go start -e /path/to/env.yaml
 or
-app start -e /path/to/env.yaml`
+app start -e /path/to/env.yaml
+or, with rocketMQ.offsetStoreDir set to /path/to/offsets
+env rocketmq.client.localOffsetStoreDir=/path/to/offsets app start -e /path/to/env.yaml`
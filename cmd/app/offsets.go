@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/linhoi/mq/external/gclient"
+	mq "github.com/linhoi/mq/protobuf"
+	"github.com/linhoi/mq/rocketmq"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func offsetsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "offsets",
+		Short:   "describe and reset offsets of a consumer group",
+		Example: offsetsExample,
+	}
+	cmd.PersistentFlags().StringP("instance", "i", "", "rocketMQ instance, default instance if empty")
+	cmd.PersistentFlags().StringP("group", "g", "", "consumer groupID")
+	cmd.PersistentFlags().StringP("topic", "t", "", "topic")
+	cmd.PersistentFlags().Duration("timeout", 30*time.Second, "timeout")
+	cmd.PersistentFlags().String("server", "", "admin API address of the running app, app.grpc.addr if empty")
+	cmd.PersistentFlags().Bool("direct", false, "access brokers directly instead of the running app, consumers of the group must be stopped before reset")
+	_ = cmd.MarkPersistentFlagRequired("group")
+
+	describe := &cobra.Command{
+		Use:   "describe",
+		Short: "show broker offsets, consumer offset and lag of each queue, all subscribed topics if topic is empty",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, q, err := newOffsetsAPI(cmd)
+			if err != nil {
+				return err
+			}
+			defer q.cleanup()
+
+			ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+			defer cancel()
+
+			offsets, err := api.Describe(ctx, q.instance, q.group, q.topic)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TOPIC\tBROKER\tQUEUE\tMIN\tMAX\tCONSUMER\tLAG")
+			var total int64
+			for _, o := range offsets {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", o.Topic, o.Broker, o.QueueID, o.MinOffset, o.MaxOffset, o.ConsumerOffset, o.Lag)
+				total += o.Lag
+			}
+			fmt.Fprintf(w, "TOTAL\t\t\t\t\t\t%d\n", total)
+			return w.Flush()
+		},
+	}
+
+	reset := &cobra.Command{
+		Use:   "reset",
+		Short: "reset offsets of the group on a topic to a time, the earliest or the latest",
+		Long: `reset offsets of the group on a topic to a time, the earliest or the latest.
+the running app stops the group, resets its offsets and restarts it. other processes consuming
+with the same group must be stopped first, otherwise they overwrite the reset offsets.`,
+		RunE: runReset,
+	}
+	reset.Flags().String("to", "", `"earliest", "latest", or a time "`+timeLayout+`" / a duration ago such as 6h`)
+	reset.Flags().Bool("dry-run", false, "print the offsets to reset to without resetting")
+	_ = reset.MarkFlagRequired("to")
+
+	cmd.AddCommand(describe, reset)
+	return cmd
+}
+
+func runReset(cmd *cobra.Command, _ []string) error {
+	to, _ := cmd.Flags().GetString("to")
+	var t time.Time
+	if to != rocketmq.ResetToEarliest && to != rocketmq.ResetToLatest {
+		var err error
+		if t, err = parseTime(cmd, "to"); err != nil {
+			return err
+		}
+		to = rocketmq.ResetToTimestamp
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	api, q, err := newOffsetsAPI(cmd)
+	if err != nil {
+		return err
+	}
+	defer q.cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+
+	resets, err := api.Reset(ctx, q.instance, q.group, q.topic, to, t, dryRun)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tBROKER\tQUEUE\tPREVIOUS\tOFFSET\tLAG")
+	for _, r := range resets {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", r.Topic, r.Broker, r.QueueID, r.PreviousOffset, r.ConsumerOffset, r.Lag)
+	}
+	_ = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Printf("%d queues of %s would be reset\n", len(resets), q.group)
+		return nil
+	}
+	fmt.Printf("%d queues of %s reset\n", len(resets), q.group)
+	return nil
+}
+
+// offsetsAPI 由运行中的 app 的运维接口或直接访问 broker 实现.
+type offsetsAPI interface {
+	Describe(ctx context.Context, instance, group, topic string) ([]*rocketmq.QueueOffset, error)
+	Reset(ctx context.Context, instance, group, topic, to string, t time.Time, dryRun bool) ([]*rocketmq.ResetOffset, error)
+}
+
+type offsetsFlags struct {
+	instance string
+	group    string
+	topic    string
+	timeout  time.Duration
+	cleanup  func()
+}
+
+func newOffsetsAPI(cmd *cobra.Command) (offsetsAPI, offsetsFlags, error) {
+	q := offsetsFlags{cleanup: func() {}}
+	q.instance, _ = cmd.Flags().GetString("instance")
+	q.group, _ = cmd.Flags().GetString("group")
+	q.topic, _ = cmd.Flags().GetString("topic")
+	q.timeout, _ = cmd.Flags().GetDuration("timeout")
+	server, _ := cmd.Flags().GetString("server")
+	direct, _ := cmd.Flags().GetBool("direct")
+
+	conf, err := loadConfig(cmd)
+	if err != nil {
+		return nil, q, err
+	}
+	if direct {
+		return rocketmq.NewOffsets(conf, rocketmq.NewAdmin(conf), nil), q, nil
+	}
+
+	if server == "" {
+		server = conf.App.GRPC.Addr
+	}
+	conn, cancel, err := gclient.New(gclient.WithTarget(server))
+	if err != nil {
+		return nil, q, err
+	}
+	q.cleanup = func() {
+		cancel()
+		_ = conn.Close()
+	}
+	return remoteOffsets{client: mq.NewAdminAPIClient(conn)}, q, nil
+}
+
+type remoteOffsets struct {
+	client mq.AdminAPIClient
+}
+
+func (r remoteOffsets) Describe(ctx context.Context, instance, group, topic string) ([]*rocketmq.QueueOffset, error) {
+	resp, err := r.client.DescribeOffsets(ctx, &mq.DescribeOffsetsRequest{Instance: instance, Group: group, Topic: topic})
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]*rocketmq.QueueOffset, 0, len(resp.Offsets))
+	for _, o := range resp.Offsets {
+		offset := fromQueueOffset(o)
+		offsets = append(offsets, &offset)
+	}
+	return offsets, nil
+}
+
+func (r remoteOffsets) Reset(ctx context.Context, instance, group, topic, to string, t time.Time, dryRun bool) ([]*rocketmq.ResetOffset, error) {
+	req := &mq.ResetOffsetsRequest{Instance: instance, Group: group, Topic: topic, To: to, DryRun: dryRun}
+	if !t.IsZero() {
+		req.Timestamp = t.UnixNano() / int64(time.Millisecond)
+	}
+	resp, err := r.client.ResetOffsets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resets := make([]*rocketmq.ResetOffset, 0, len(resp.Offsets))
+	for _, o := range resp.Offsets {
+		resets = append(resets, &rocketmq.ResetOffset{QueueOffset: fromQueueOffset(o), PreviousOffset: o.PreviousOffset})
+	}
+	return resets, nil
+}
+
+func fromQueueOffset(o *mq.QueueOffset) rocketmq.QueueOffset {
+	return rocketmq.QueueOffset{
+		Topic:          o.Topic,
+		Broker:         o.Broker,
+		QueueID:        int(o.QueueId),
+		MinOffset:      o.MinOffset,
+		MaxOffset:      o.MaxOffset,
+		ConsumerOffset: o.ConsumerOffset,
+		Lag:            o.Lag,
+	}
+}
+
+const offsetsExample = `app offsets describe -g GID_for_consumer
+app offsets reset -g GID_for_consumer -t topic --to 6h --dry-run
+app offsets reset -g GID_for_consumer -t topic --to "2021-06-01 08:00:00"
+app offsets reset -g GID_for_consumer -t topic --to latest --server 10.0.0.1:9090
+app offsets reset -g GID_for_consumer -t topic --to earliest --direct`
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+func queryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "query",
+		Short:   "query messages of a rocketMQ instance",
+		Example: queryExample,
+	}
+	cmd.PersistentFlags().StringP("instance", "i", "", "rocketMQ instance, default instance if empty")
+	cmd.PersistentFlags().StringP("topic", "t", "", "topic")
+	cmd.PersistentFlags().StringSliceP("group", "g", nil, "extra consumer groups to show consumption status for")
+	cmd.PersistentFlags().Duration("timeout", 10*time.Second, "query timeout")
+
+	byID := &cobra.Command{
+		Use:   "id <msgId>",
+		Short: "query message by msgId or offsetMsgId",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runQuery(cmd, func(ctx context.Context, a *rocketmq.Admin, q queryFlags) ([]*rocketmq.MessageView, error) {
+				return a.QueryByID(ctx, q.instance, q.topic, args[0], q.groups)
+			})
+		},
+	}
+
+	byKey := &cobra.Command{
+		Use:   "key <key>",
+		Short: "query messages by business key within a time range",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			begin, err := parseTime(cmd, "begin")
+			if err != nil {
+				return err
+			}
+			end, err := parseTime(cmd, "end")
+			if err != nil {
+				return err
+			}
+			max, _ := cmd.Flags().GetInt("max")
+
+			return runQuery(cmd, func(ctx context.Context, a *rocketmq.Admin, q queryFlags) ([]*rocketmq.MessageView, error) {
+				return a.QueryByKey(ctx, q.instance, q.topic, args[0], begin, end, max, q.groups)
+			})
+		},
+	}
+	byKey.Flags().String("begin", "24h", `begin time, "`+timeLayout+`" or a duration ago such as 6h`)
+	byKey.Flags().String("end", "", `end time, "`+timeLayout+`" or a duration ago, now if empty`)
+	byKey.Flags().Int("max", 64, "max messages to return")
+
+	byOffset := &cobra.Command{
+		Use:   "offset",
+		Short: "query messages of a queue by offset range",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			broker, _ := cmd.Flags().GetString("broker")
+			queue, _ := cmd.Flags().GetInt("queue")
+			begin, _ := cmd.Flags().GetInt64("begin")
+			end, _ := cmd.Flags().GetInt64("end")
+
+			return runQuery(cmd, func(ctx context.Context, a *rocketmq.Admin, q queryFlags) ([]*rocketmq.MessageView, error) {
+				return a.QueryByOffset(ctx, q.instance, q.topic, broker, queue, begin, end, q.groups)
+			})
+		},
+	}
+	byOffset.Flags().String("broker", "", "broker name, may be empty if the topic lives on one broker")
+	byOffset.Flags().Int("queue", 0, "queue id")
+	byOffset.Flags().Int64("begin", 0, "begin offset (inclusive)")
+	byOffset.Flags().Int64("end", 0, "end offset (exclusive), begin+1 if not greater than begin, at most 256 offsets after begin")
+
+	cmd.AddCommand(byID, byKey, byOffset)
+	return cmd
+}
+
+type queryFlags struct {
+	instance string
+	topic    string
+	groups   []string
+}
+
+func runQuery(cmd *cobra.Command, query func(context.Context, *rocketmq.Admin, queryFlags) ([]*rocketmq.MessageView, error)) error {
+	conf, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	q := queryFlags{}
+	q.instance, _ = cmd.Flags().GetString("instance")
+	q.topic, _ = cmd.Flags().GetString("topic")
+	q.groups, _ = cmd.Flags().GetStringSlice("group")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	views, err := query(ctx, rocketmq.NewAdmin(conf), q)
+	if err != nil {
+		return err
+	}
+	return printJSON(views)
+}
+
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	envPath, err := cmd.Root().PersistentFlags().GetString("env")
+	if err != nil {
+		return nil, err
+	}
+	return config.New(config.Env(envPath), nil), nil
+}
+
+// parseTime 解析绝对时间或相对当前的时长, 空值返回零值.
+func parseTime(cmd *cobra.Command, name string) (time.Time, error) {
+	val, err := cmd.Flags().GetString(name)
+	if err != nil || val == "" {
+		return time.Time{}, err
+	}
+
+	if d, err := time.ParseDuration(val); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(timeLayout, val, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("invalid --%s %q, want %q, RFC3339 or a duration", name, val, timeLayout)
+}
+
+const queryExample = `app query id 0A0A0A0A00002A9F0000000000000001 -e env.yaml
+app query id 7F00000100002A9F0000000000000001 -t topic
+app query key order-123 -t topic --begin 6h
+app query offset -t topic --broker broker-a --queue 0 --begin 100 --end 110`
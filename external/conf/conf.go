@@ -11,6 +11,7 @@ type options struct {
 	file   string
 	apollo *Apollo // apollo配置信息
 	apolloSwitch bool
+	onChange func()
 }
 
 func WithFile(file string) Option {
@@ -33,6 +34,13 @@ func WithApollo(apollo *Apollo) Option {
 	}
 }
 
+// WithOnChange 配置热更新后回调
+func WithOnChange(fn func()) Option {
+	return func(o *options) {
+		o.onChange = fn
+	}
+}
+
 func WithoutApollo() Option {
 	return func(o *options) {
 		o.apolloSwitch = false
@@ -49,6 +57,7 @@ func New(config interface{}, opts ...Option) error {
 		file:   o.file,
 		config: config,
 		apollo: o.apollo,
+		onChange: o.onChange,
 	}
 
 	err := manager.getConfFromFile()
@@ -24,9 +24,10 @@ const (
 )
 
 type Manager struct {
-	file   string      //文件名称
-	config interface{} // 全局配置的指针
-	apollo *Apollo     // apollo配置信息
+	file     string      //文件名称
+	config   interface{} // 全局配置的指针
+	apollo   *Apollo     // apollo配置信息
+	onChange func()      // 配置更新后回调
 }
 
 func (m Manager) getConfFromFile() error {
@@ -155,6 +156,9 @@ func (m Manager) onConfigChange(v *viper.Viper, pv provider) {
 	if !reflect.DeepEqual(currentConfig, dynamicConfig) {
 		logger.Infow("update config from", "source", pv)
 		m.updateConfig(dynamicConfig)
+		if m.onChange != nil {
+			m.onChange()
+		}
 	}
 
 }
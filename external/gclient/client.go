@@ -2,8 +2,11 @@ package gclient
 
 import (
 	"context"
+	"errors"
 	"git.baijia.com/go/kit/xgrpc/interceptor/grpc_zap"
+	_ "github.com/linhoi/mq/external/gclient/resolver/consul"
 	"github.com/linhoi/mq/external/gclient/resolver/dns"
+	"github.com/linhoi/mq/external/gclient/resolver/static"
 	"github.com/linhoi/mq/external/grpcserver/interceptor/grpc_prometheus"
 	"sync"
 
@@ -21,6 +24,9 @@ var oc sync.Once
 func init() {
 	//dns://
 	resolver.Register(dns.NewBuilder(""))
+	//static:///host1:port1,host2:port2
+	resolver.Register(static.NewBuilder())
+	//consul:// 在 resolver/consul 的 init 中注册
 }
 
 func New(opts ...Option) (cc *grpc.ClientConn, cancel context.CancelFunc, err error) {
@@ -32,11 +38,16 @@ func New(opts ...Option) (cc *grpc.ClientConn, cancel context.CancelFunc, err er
 
 	resolverRegister(o)
 
+	security, err := getSecurityOptions(o)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
 	clientConn, err := grpc.DialContext(
 		ctx,
 		getTarget(o),
-		getDialOptions(o)...,
+		append(getDialOptions(o), security...)...,
 	)
 
 	return clientConn, cancel, err
@@ -45,7 +56,6 @@ func New(opts ...Option) (cc *grpc.ClientConn, cancel context.CancelFunc, err er
 func getDialOptions(defaultOptions *options) []grpc.DialOption {
 	os := []grpc.DialOption{
 		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "round_robin"}`),
-		grpc.WithInsecure(),
 		grpc.WithUnaryInterceptor(
 			grpcmiddleware.ChainUnaryClient(
 				grpcopentracing.UnaryClientInterceptor( //配置分布式追踪
@@ -74,6 +84,32 @@ func getDialOptions(defaultOptions *options) []grpc.DialOption {
 	return os
 }
 
+// getSecurityOptions 未设置 TLS 时使用明文连接, 证书与 token 文件在建立连接前校验.
+func getSecurityOptions(defaultOptions *options) ([]grpc.DialOption, error) {
+	var os []grpc.DialOption
+	if defaultOptions.tls {
+		creds, err := newTLSCredentials(defaultOptions)
+		if err != nil {
+			return nil, err
+		}
+		os = append(os, grpc.WithTransportCredentials(creds))
+	} else {
+		os = append(os, grpc.WithInsecure())
+	}
+
+	if defaultOptions.tokenFile != "" {
+		if !defaultOptions.tls {
+			return nil, errors.New("grpc client token requires tls")
+		}
+		creds, err := newTokenCredentials(defaultOptions.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		os = append(os, grpc.WithPerRPCCredentials(creds))
+	}
+	return os, nil
+}
+
 func resolverRegister(defaultOptions *options) {
 	if defaultOptions.proxyAddress == "" {
 		return
@@ -0,0 +1,196 @@
+package gclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadInterval 两次检查证书与 token 文件是否更新的最小间隔.
+const reloadInterval = time.Second
+
+// reloader 在文件修改后重新加载, 加载失败时沿用上次的结果, 避免轮换证书时读到写了一半的文件.
+type reloader struct {
+	files []string
+	load  func() (interface{}, error)
+
+	mu      sync.Mutex
+	value   interface{}
+	stamp   string
+	checked time.Time
+}
+
+func newReloader(load func() (interface{}, error), files ...string) (*reloader, error) {
+	r := &reloader{files: files, load: load}
+	if _, err := r.get(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *reloader) get() (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.value != nil && time.Since(r.checked) < reloadInterval {
+		return r.value, nil
+	}
+	r.checked = time.Now()
+
+	stamp, err := fileStamp(r.files)
+	if err == nil && r.value != nil && stamp == r.stamp {
+		return r.value, nil
+	}
+	if err == nil {
+		var value interface{}
+		if value, err = r.load(); err == nil {
+			r.value, r.stamp = value, stamp
+			return value, nil
+		}
+	}
+	if r.value != nil {
+		zap.L().Warn("grpc client reload credentials failed, use last loaded", zap.Strings("files", r.files), zap.Error(err))
+		return r.value, nil
+	}
+	return nil, err
+}
+
+// fileStamp 文件的修改时间与大小, 用于判断文件是否更新.
+func fileStamp(files []string) (string, error) {
+	var b strings.Builder
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String(), nil
+}
+
+// tlsCredentials 每次建立连接时使用最新的证书, serverName 在每次使用重新加载的配置时设置.
+type tlsCredentials struct {
+	config *reloader
+
+	mu         sync.Mutex
+	serverName string
+}
+
+func newTLSCredentials(o *options) (credentials.TransportCredentials, error) {
+	if (o.certFile == "") != (o.keyFile == "") {
+		return nil, fmt.Errorf("grpc client tls: certFile and keyFile must be set together")
+	}
+	config, err := newReloader(func() (interface{}, error) {
+		return loadTLSConfig(o)
+	}, o.caFile, o.certFile, o.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsCredentials{serverName: o.serverName, config: config}, nil
+}
+
+func loadTLSConfig(o *options) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: o.insecureSkipVerify}
+	if o.caFile != "" {
+		pem, err := ioutil.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc client tls: read ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("grpc client tls: no certificate found in %s", o.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc client tls: load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (c *tlsCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	loaded, err := c.config.get()
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := loaded.(*tls.Config).Clone()
+	cfg.ServerName = c.getServerName()
+	return credentials.NewTLS(cfg).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *tlsCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, fmt.Errorf("grpc client tls: server handshake is not supported")
+}
+
+func (c *tlsCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2", ServerName: c.getServerName()}
+}
+
+func (c *tlsCredentials) Clone() credentials.TransportCredentials {
+	return &tlsCredentials{serverName: c.getServerName(), config: c.config}
+}
+
+func (c *tlsCredentials) OverrideServerName(serverName string) error {
+	c.mu.Lock()
+	c.serverName = serverName
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *tlsCredentials) getServerName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.serverName
+}
+
+// tokenCredentials 每次调用携带文件中最新的 bearer token.
+type tokenCredentials struct {
+	token *reloader
+}
+
+func newTokenCredentials(tokenFile string) (credentials.PerRPCCredentials, error) {
+	token, err := newReloader(func() (interface{}, error) {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc client token: %v", err)
+		}
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return nil, fmt.Errorf("grpc client token: %s is empty", tokenFile)
+		}
+		return token, nil
+	}, tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenCredentials{token: token}, nil
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.token.get()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token.(string)}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -43,6 +43,13 @@ type options struct {
 	retryBackoff          grpcretry.BackoffFunc
 	block                 bool
 	shouldTrace           bool
+	tls                   bool
+	caFile                string
+	certFile              string
+	keyFile               string
+	serverName            string
+	insecureSkipVerify    bool
+	tokenFile             string
 }
 
 // dns服务发现时的降级反向代理地址
@@ -99,6 +106,53 @@ func WithBlock() Option {
 	}
 }
 
+// WithTLS 使用 TLS 连接, 未设置 CA 时使用系统根证书.
+func WithTLS() Option {
+	return func(o *options) {
+		o.tls = true
+	}
+}
+
+// WithCAFile 校验服务端证书的 CA, 文件更新后自动重新加载.
+func WithCAFile(caFile string) Option {
+	return func(o *options) {
+		o.tls = true
+		o.caFile = caFile
+	}
+}
+
+// WithClientCert mTLS 的客户端证书与私钥, 文件更新后自动重新加载.
+func WithClientCert(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.tls = true
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithServerName 覆盖校验服务端证书时使用的域名.
+func WithServerName(serverName string) Option {
+	return func(o *options) {
+		o.tls = true
+		o.serverName = serverName
+	}
+}
+
+// WithInsecureSkipVerify 不校验服务端证书, 只用于测试.
+func WithInsecureSkipVerify() Option {
+	return func(o *options) {
+		o.tls = true
+		o.insecureSkipVerify = true
+	}
+}
+
+// WithTokenFile 每次调用携带文件中的 bearer token, 文件更新后自动重新读取, 需要 TLS.
+func WithTokenFile(tokenFile string) Option {
+	return func(o *options) {
+		o.tokenFile = tokenFile
+	}
+}
+
 func WithShouldTrace(logLevel string) Option {
 	return func(o *options) {
 		if strings.ToLower(logLevel) == "debug" {
@@ -0,0 +1,52 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Lookup 解析 dns://[authority]/host[:port] 的全部后端地址, 用于需要逐个访问后端的场景, 如广播回调.
+func Lookup(ctx context.Context, target string) ([]string, error) {
+	rest := strings.TrimPrefix(target, Scheme+"://")
+	if rest == target {
+		return nil, fmt.Errorf("dns resolver: invalid target %s", target)
+	}
+
+	var authority, endpoint string
+	if i := strings.Index(rest, "/"); i >= 0 {
+		authority, endpoint = rest[:i], rest[i+1:]
+	} else {
+		endpoint = rest
+	}
+
+	host, port, err := parseTarget(endpoint, defaultPort)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		host, _ = formatIP(host)
+		return []string{host + ":" + port}, nil
+	}
+
+	r := defaultResolver
+	if authority != "" {
+		if r, err = customAuthorityResolver(authority); err != nil {
+			return nil, err
+		}
+	}
+
+	ips, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, ip := range ips {
+		if ip, ok := formatIP(ip); ok {
+			addrs = append(addrs, ip+":"+port)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,75 @@
+package static
+
+import (
+	"fmt"
+	"google.golang.org/grpc/resolver"
+	"net"
+	"strings"
+)
+
+// Scheme static:///host1:port1,host2:port2 固定地址列表, 地址之间轮询.
+const Scheme = "static"
+
+// NewBuilder creates a staticBuilder which resolves the comma separated addresses in the endpoint.
+func NewBuilder() resolver.Builder {
+	return &staticBuilder{}
+}
+
+type staticBuilder struct{}
+
+func (b *staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs, err := Parse(target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	state := resolver.State{Addresses: make([]resolver.Address, 0, len(addrs))}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	if err = cc.UpdateState(state); err != nil {
+		return nil, err
+	}
+	return staticResolver{}, nil
+}
+
+// Scheme returns the naming scheme of this resolver builder, which is "static".
+func (b *staticBuilder) Scheme() string {
+	return Scheme
+}
+
+// staticResolver 地址固定, 不需要重新解析.
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
+
+// Parse 解析逗号分隔的 host:port 列表.
+func Parse(endpoint string) ([]string, error) {
+	var addrs []string
+	for _, addr := range strings.Split(endpoint, ",") {
+		addr = strings.TrimSpace(addr)
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("static resolver: invalid address %q: %v", addr, err)
+		}
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("static resolver: address %q must be host:port", addr)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// Lookup 返回 static:///host1:port1,host2:port2 的全部地址, 用于需要逐个访问后端的场景, 如广播回调.
+func Lookup(target string) ([]string, error) {
+	rest := strings.TrimPrefix(target, Scheme+"://")
+	if rest == target {
+		return nil, fmt.Errorf("static resolver: invalid target %s", target)
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return Parse(rest)
+}
@@ -6,6 +6,7 @@ import (
 
 	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/logging"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
 )
 
 func newDefaultServerOptions() *options {
@@ -28,4 +29,12 @@ type options struct {
 	logger               *zap.Logger
 	maxConcurrentStreams uint32
 	loggingDecider       grpc_logging.Decider
+	health               *health.Server
+}
+
+// WithHealthServer 使用调用方的健康检查服务, 由调用方设置服务状态.
+func WithHealthServer(h *health.Server) Option {
+	return func(o *options) {
+		o.health = h
+	}
 }
@@ -70,7 +70,10 @@ func New(opts ...Option) *grpc.Server {
 	// 反射
 	reflection.Register(s)
 	// 健康检查
-	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	if o.health == nil {
+		o.health = health.NewServer()
+	}
+	grpc_health_v1.RegisterHealthServer(s, o.health)
 
 	return s
 }
@@ -0,0 +1,121 @@
+// Package webhook 校验 mq 的 http 回调签名.
+//
+// 每次回调的请求头带有签名时间戳与签名:
+//
+//	X-MQ-Timestamp: 1700000000
+//	X-MQ-Signature: v1=5257a869...,v1=9e1a2f3b...
+//
+// 签名为 hex(HMAC-SHA256(secret, timestamp + "." + body)). 轮换 secret 时 mq 同时使用新旧两个 secret 签名,
+// 接收方配置其中任意一个即可通过校验.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-MQ-Timestamp"
+	HeaderSignature = "X-MQ-Signature"
+
+	// DefaultTolerance 签名时间与当前时间允许的最大偏差, 防止请求被重放.
+	DefaultTolerance = 5 * time.Minute
+
+	signatureVersion = "v1"
+)
+
+var (
+	ErrMissingSignature  = errors.New("webhook: missing signature")
+	ErrInvalidTimestamp  = errors.New("webhook: invalid timestamp")
+	ErrTimestampExpired  = errors.New("webhook: timestamp outside tolerance")
+	ErrSignatureMismatch = errors.New("webhook: signature mismatch")
+)
+
+// Sign 返回一个 secret 对 timestamp 与 body 的签名.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader 返回每个 secret 的签名组成的 X-MQ-Signature 请求头.
+func SignatureHeader(secrets []string, timestamp int64, body []byte) string {
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		signatures = append(signatures, signatureVersion+"="+Sign(secret, timestamp, body))
+	}
+	return strings.Join(signatures, ",")
+}
+
+// Verify 校验签名, 任一 secret 与任一签名匹配即通过. tolerance 为0时使用 DefaultTolerance.
+func Verify(secrets []string, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > tolerance || skew < -tolerance {
+		return ErrTimestampExpired
+	}
+
+	for _, secret := range secrets {
+		expected := []byte(Sign(secret, ts, body))
+		for _, part := range strings.Split(signature, ",") {
+			version, sig := splitSignature(part)
+			if version == signatureVersion && hmac.Equal([]byte(sig), expected) {
+				return nil
+			}
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// VerifyRequest 读取并校验请求体, 校验后请求体可以再次读取.
+func VerifyRequest(r *http.Request, secrets []string, tolerance time.Duration) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "webhook: read body")
+	}
+	_ = r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = Verify(secrets, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, tolerance)
+	return body, err
+}
+
+// Middleware 拒绝签名校验失败的请求, 返回 401.
+func Middleware(secrets []string, tolerance time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := VerifyRequest(r, secrets, tolerance); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func splitSignature(s string) (version, signature string) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return "", ""
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"msgId":"1"}`)
+	now := time.Now().Unix()
+	ts := strconv.FormatInt(now, 10)
+
+	tests := []struct {
+		name      string
+		secrets   []string // 接收方配置的 secret.
+		timestamp string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{
+			name:      "one secret",
+			secrets:   []string{"s1"},
+			timestamp: ts,
+			signature: SignatureHeader([]string{"s1"}, now, body),
+			body:      body,
+		},
+		{
+			name:      "rotation, receiver has new secret",
+			secrets:   []string{"new"},
+			timestamp: ts,
+			signature: SignatureHeader([]string{"new", "old"}, now, body),
+			body:      body,
+		},
+		{
+			name:      "rotation, receiver has old secret",
+			secrets:   []string{"old"},
+			timestamp: ts,
+			signature: SignatureHeader([]string{"new", "old"}, now, body),
+			body:      body,
+		},
+		{
+			name:      "rotation, receiver has both secrets",
+			secrets:   []string{"new", "old"},
+			timestamp: ts,
+			signature: "v1=" + Sign("old", now, body),
+			body:      body,
+		},
+		{
+			name:      "wrong secret",
+			secrets:   []string{"other"},
+			timestamp: ts,
+			signature: SignatureHeader([]string{"new", "old"}, now, body),
+			body:      body,
+			want:      ErrSignatureMismatch,
+		},
+		{
+			name:      "tampered body",
+			secrets:   []string{"s1"},
+			timestamp: ts,
+			signature: SignatureHeader([]string{"s1"}, now, body),
+			body:      []byte(`{"msgId":"2"}`),
+			want:      ErrSignatureMismatch,
+		},
+		{
+			name:      "tampered timestamp",
+			secrets:   []string{"s1"},
+			timestamp: strconv.FormatInt(now-1, 10),
+			signature: SignatureHeader([]string{"s1"}, now, body),
+			body:      body,
+			want:      ErrSignatureMismatch,
+		},
+		{
+			name:      "unknown version",
+			secrets:   []string{"s1"},
+			timestamp: ts,
+			signature: "v0=" + Sign("s1", now, body),
+			body:      body,
+			want:      ErrSignatureMismatch,
+		},
+		{
+			name:      "expired timestamp",
+			secrets:   []string{"s1"},
+			timestamp: strconv.FormatInt(now-600, 10),
+			signature: SignatureHeader([]string{"s1"}, now-600, body),
+			body:      body,
+			want:      ErrTimestampExpired,
+		},
+		{
+			name:      "future timestamp",
+			secrets:   []string{"s1"},
+			timestamp: strconv.FormatInt(now+600, 10),
+			signature: SignatureHeader([]string{"s1"}, now+600, body),
+			body:      body,
+			want:      ErrTimestampExpired,
+		},
+		{
+			name:      "invalid timestamp",
+			secrets:   []string{"s1"},
+			timestamp: "yesterday",
+			signature: SignatureHeader([]string{"s1"}, now, body),
+			body:      body,
+			want:      ErrInvalidTimestamp,
+		},
+		{
+			name:    "missing signature",
+			secrets: []string{"s1"},
+			body:    body,
+			want:    ErrMissingSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secrets, tt.timestamp, tt.signature, tt.body, 0); err != tt.want {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	body := []byte("body")
+	ts := time.Now().Add(-time.Hour).Unix()
+	signature := SignatureHeader([]string{"s1"}, ts, body)
+
+	if err := Verify([]string{"s1"}, strconv.FormatInt(ts, 10), signature, body, 2*time.Hour); err != nil {
+		t.Errorf("Verify() with 2h tolerance = %v, want nil", err)
+	}
+	if err := Verify([]string{"s1"}, strconv.FormatInt(ts, 10), signature, body, 0); err != ErrTimestampExpired {
+		t.Errorf("Verify() with default tolerance = %v, want %v", err, ErrTimestampExpired)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	body := `{"msgId":"1"}`
+	now := time.Now().Unix()
+
+	r := httptest.NewRequest(http.MethodPut, "/callback", strings.NewReader(body))
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(now, 10))
+	r.Header.Set(HeaderSignature, SignatureHeader([]string{"new", "old"}, now, []byte(body)))
+
+	got, err := VerifyRequest(r, []string{"old"}, 0)
+	if err != nil {
+		t.Fatalf("VerifyRequest() error = %v", err)
+	}
+	if string(got) != body {
+		t.Errorf("VerifyRequest() body = %q, want %q", got, body)
+	}
+
+	// 校验后请求体可以再次读取.
+	again, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("read body again: %v", err)
+	}
+	if string(again) != body {
+		t.Errorf("body read again = %q, want %q", again, body)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	body := `{"msgId":"1"}`
+	now := time.Now().Unix()
+
+	var received string
+	handler := Middleware([]string{"s1"}, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = string(b)
+	}))
+
+	r := httptest.NewRequest(http.MethodPut, "/callback", strings.NewReader(body))
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(now, 10))
+	r.Header.Set(HeaderSignature, SignatureHeader([]string{"s1"}, now, []byte(body)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || received != body {
+		t.Errorf("signed request: status %d, body %q, want 200 and %q", w.Code, received, body)
+	}
+
+	received = ""
+	r = httptest.NewRequest(http.MethodPut, "/callback", strings.NewReader(`{"msgId":"2"}`))
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(now, 10))
+	r.Header.Set(HeaderSignature, SignatureHeader([]string{"s1"}, now, []byte(body)))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || received != "" {
+		t.Errorf("tampered request: status %d, handler called %v, want 401 and not called", w.Code, received != "")
+	}
+}
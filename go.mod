@@ -29,6 +29,7 @@ require (
 	github.com/uber/jaeger-client-go v2.16.0+incompatible
 	go.uber.org/zap v1.18.1
 	golang.org/x/net v0.0.0-20210525063256-abc453219eb5
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	google.golang.org/grpc v1.39.0
 	google.golang.org/protobuf v1.27.1
 )
@@ -0,0 +1,186 @@
+package grpc
+
+import (
+	"context"
+	mq "github.com/linhoi/mq/protobuf"
+	rocketmq2 "github.com/linhoi/mq/rocketmq"
+	"github.com/linhoi/mq/rocketmq/admin"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type AdminAPI struct {
+	admin   *rocketmq2.Admin
+	offsets *rocketmq2.Offsets
+	*mq.UnimplementedAdminAPIServer
+}
+
+func NewAdminAPI(admin *rocketmq2.Admin, offsets *rocketmq2.Offsets) *AdminAPI {
+	return &AdminAPI{admin: admin, offsets: offsets}
+}
+
+func (s *AdminAPI) QueryMessageByID(ctx context.Context, req *mq.QueryMessageByIDRequest) (*mq.QueryMessageResponse, error) {
+	if req.MsgId == "" {
+		return nil, status.Error(codes.InvalidArgument, "msg_id is required")
+	}
+
+	views, err := s.admin.QueryByID(ctx, req.Instance, req.Topic, req.MsgId, req.Groups)
+	return queryMessageResponse(views, err)
+}
+
+func (s *AdminAPI) QueryMessageByKey(ctx context.Context, req *mq.QueryMessageByKeyRequest) (*mq.QueryMessageResponse, error) {
+	if req.Topic == "" || req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic and key are required")
+	}
+
+	var end time.Time
+	if req.EndTs > 0 {
+		end = fromMillis(req.EndTs)
+	}
+	views, err := s.admin.QueryByKey(ctx, req.Instance, req.Topic, req.Key, fromMillis(req.BeginTs), end, int(req.MaxNum), req.Groups)
+	return queryMessageResponse(views, err)
+}
+
+func (s *AdminAPI) QueryMessageByOffset(ctx context.Context, req *mq.QueryMessageByOffsetRequest) (*mq.QueryMessageResponse, error) {
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic is required")
+	}
+
+	views, err := s.admin.QueryByOffset(ctx, req.Instance, req.Topic, req.Broker, int(req.QueueId), req.BeginOffset, req.EndOffset, req.Groups)
+	return queryMessageResponse(views, err)
+}
+
+func (s *AdminAPI) DescribeOffsets(ctx context.Context, req *mq.DescribeOffsetsRequest) (*mq.DescribeOffsetsResponse, error) {
+	if req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "group is required")
+	}
+
+	offsets, err := s.offsets.Describe(ctx, req.Instance, req.Group, req.Topic)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	resp := &mq.DescribeOffsetsResponse{}
+	for _, o := range offsets {
+		resp.Offsets = append(resp.Offsets, queueOffset(o))
+		resp.TotalLag += o.Lag
+	}
+	return resp, nil
+}
+
+func (s *AdminAPI) ResetOffsets(ctx context.Context, req *mq.ResetOffsetsRequest) (*mq.ResetOffsetsResponse, error) {
+	if req.Group == "" || req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "group and topic are required")
+	}
+	switch req.To {
+	case rocketmq2.ResetToEarliest, rocketmq2.ResetToLatest:
+	case rocketmq2.ResetToTimestamp:
+		if req.Timestamp <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "timestamp is required")
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "to must be %s, %s or %s",
+			rocketmq2.ResetToEarliest, rocketmq2.ResetToLatest, rocketmq2.ResetToTimestamp)
+	}
+
+	resets, err := s.offsets.Reset(ctx, req.Instance, req.Group, req.Topic, req.To, fromMillis(req.Timestamp), req.DryRun)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	resp := &mq.ResetOffsetsResponse{}
+	for _, r := range resets {
+		o := queueOffset(&r.QueueOffset)
+		o.PreviousOffset = r.PreviousOffset
+		resp.Offsets = append(resp.Offsets, o)
+	}
+	return resp, nil
+}
+
+func (s *AdminAPI) RouteMessage(ctx context.Context, req *mq.RouteMessageRequest) (*mq.RouteMessageResponse, error) {
+	if req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "group is required")
+	}
+
+	result, err := s.admin.Route(req.Instance, req.Group, req.Tags, req.Keys, req.Properties)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	resp := &mq.RouteMessageResponse{Route: result.Route}
+	for _, d := range result.Destinations {
+		resp.Destinations = append(resp.Destinations, &mq.RouteDestination{
+			Name:        d.Name,
+			CallbackUrl: d.CallbackURL,
+			Policy:      d.Policy,
+		})
+	}
+	return resp, nil
+}
+
+func queueOffset(o *rocketmq2.QueueOffset) *mq.QueueOffset {
+	return &mq.QueueOffset{
+		Topic:          o.Topic,
+		Broker:         o.Broker,
+		QueueId:        int32(o.QueueID),
+		MinOffset:      o.MinOffset,
+		MaxOffset:      o.MaxOffset,
+		ConsumerOffset: o.ConsumerOffset,
+		Lag:            o.Lag,
+	}
+}
+
+func queryMessageResponse(views []*rocketmq2.MessageView, err error) (*mq.QueryMessageResponse, error) {
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	resp := &mq.QueryMessageResponse{}
+	for _, v := range views {
+		msg := &mq.MessageView{
+			MsgId:          v.MsgID,
+			OffsetMsgId:    v.OffsetMsgID,
+			Topic:          v.Topic,
+			Tags:           v.Tags,
+			Keys:           v.Keys,
+			Properties:     v.Properties,
+			Body:           v.Body,
+			BornHost:       v.BornHost,
+			BornTs:         v.BornTimestamp,
+			StoreHost:      v.StoreHost,
+			StoreTs:        v.StoreTimestamp,
+			Broker:         v.Broker,
+			QueueId:        int32(v.QueueID),
+			QueueOffset:    v.QueueOffset,
+			ReconsumeTimes: v.ReconsumeTimes,
+		}
+		for _, cs := range v.ConsumeStatuses {
+			msg.ConsumeStatuses = append(msg.ConsumeStatuses, &mq.ConsumeStatus{
+				Group:          cs.Group,
+				Status:         cs.Status,
+				ConsumerOffset: cs.ConsumerOffset,
+			})
+		}
+		resp.Messages = append(resp.Messages, msg)
+	}
+	return resp, nil
+}
+
+func adminError(err error) error {
+	if errors.Is(err, rocketmq2.ErrInvalidQuery) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if admin.IsNotFound(err) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"github.com/linhoi/mq/internal/config"
+	mq "github.com/linhoi/mq/protobuf"
+	rocketmq2 "github.com/linhoi/mq/rocketmq"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+type ConsumerGroupAPI struct {
+	streams *rocketmq2.Streams
+	*mq.UnimplementedConsumerGroupAPIServer
+}
+
+func NewConsumerGroupAPI(streams *rocketmq2.Streams) *ConsumerGroupAPI {
+	return &ConsumerGroupAPI{streams: streams}
+}
+
+func (s *ConsumerGroupAPI) Subscribe(req *mq.SubscribeRequest, stream mq.ConsumerGroupAPI_SubscribeServer) error {
+	if req.Group == "" || req.Topic == "" {
+		return status.Error(codes.InvalidArgument, "group and topic are required")
+	}
+	target, err := subscribeTarget(req.Topic, req.Selector)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sub := rocketmq2.StreamSubscription{
+		Instance:          req.Instance,
+		Group:             req.Group,
+		Target:            target,
+		MaxInflight:       int(req.MaxInflight),
+		VisibilityTimeout: time.Duration(req.VisibilityTimeoutSeconds) * time.Second,
+	}
+	err = s.streams.Subscribe(stream.Context(), sub, func(receipt string, msg *mq.Message) error {
+		return stream.Send(&mq.SubscribeResponse{Message: msg, Receipt: receipt})
+	})
+	switch {
+	case errors.Is(err, rocketmq2.ErrInvalidStream):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, rocketmq2.ErrInstanceUnknown):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, rocketmq2.ErrGroupConflict):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		// 连接 broker 失败或服务关闭, 客户端可以重试.
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return nil
+}
+
+func (s *ConsumerGroupAPI) Ack(ctx context.Context, req *mq.AckRequest) (*mq.AckResponse, error) {
+	if err := s.streams.Ack(req.Receipt); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &mq.AckResponse{}, nil
+}
+
+func (s *ConsumerGroupAPI) Nack(ctx context.Context, req *mq.NackRequest) (*mq.NackResponse, error) {
+	if err := s.streams.Nack(req.Receipt, time.Duration(req.DelaySeconds)*time.Second); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &mq.NackResponse{}, nil
+}
+
+func subscribeTarget(topic string, selector *mq.Selector) (config.Target, error) {
+	target := config.Target{Topic: topic}
+	if selector == nil || strings.TrimSpace(selector.Expression) == "" {
+		return target, nil
+	}
+
+	switch strings.ToUpper(selector.Type) {
+	case "", "TAG":
+		if strings.TrimSpace(selector.Expression) == "*" {
+			return target, nil
+		}
+		for _, tag := range strings.Split(selector.Expression, "||") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				target.Tags = append(target.Tags, tag)
+			}
+		}
+	case "SQL92":
+		target.SQL = selector.Expression
+	default:
+		return target, errors.Errorf("selector type %q, want TAG or SQL92", selector.Type)
+	}
+	return target, nil
+}
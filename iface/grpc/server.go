@@ -2,17 +2,25 @@ package grpc
 
 import (
 	"context"
-	"git.baijia.com/go/kit/xgrpc/gserver"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/external/grpcserver"
 	"github.com/linhoi/mq/internal/config"
 	mq "github.com/linhoi/mq/protobuf"
 	rocketmq2 "github.com/linhoi/mq/rocketmq"
 	"golang.org/x/net/netutil"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 	"net"
+	"sync"
+	"time"
 )
 
+// readyInterval 检查消费组是否全部运行的间隔.
+const readyInterval = time.Second
+
 type API struct {
 	producer *rocketmq2.Producer
 	*mq.UnimplementedProducerAPIServer
@@ -36,12 +44,21 @@ func (s *API) SendMessage(ctx context.Context, req *mq.SendMessageRequest) (*mq.
 }
 
 type Server struct {
-	conf      *config.Config
-	API *API
+	conf             *config.Config
+	API              *API
+	AdminAPI         *AdminAPI
+	ConsumerGroupAPI *ConsumerGroupAPI
+	consumer         *rocketmq2.Consumer
+	health           *health.Server
+	mu               sync.Mutex
+	server           *grpc.Server
+	done             chan struct{}
 }
 
-func NewServer(conf *config.Config, API *API) *Server {
-	return &Server{conf: conf, API: API}
+func NewServer(conf *config.Config, API *API, adminAPI *AdminAPI, consumerGroupAPI *ConsumerGroupAPI, consumer *rocketmq2.Consumer) *Server {
+	h := health.NewServer()
+	h.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	return &Server{conf: conf, API: API, AdminAPI: adminAPI, ConsumerGroupAPI: consumerGroupAPI, consumer: consumer, health: h, done: make(chan struct{})}
 }
 
 func (g *Server) Start() error {
@@ -50,8 +67,54 @@ func (g *Server) Start() error {
 		return err
 	}
 	lis = netutil.LimitListener(lis, 2046)
-	s := gserver.New()
+	s := grpcserver.New(grpcserver.WithHealthServer(g.health))
 	mq.RegisterProducerAPIServer(s, g.API)
+	mq.RegisterAdminAPIServer(s, g.AdminAPI)
+	mq.RegisterConsumerGroupAPIServer(s, g.ConsumerGroupAPI)
+	g.mu.Lock()
+	g.server = s
+	g.mu.Unlock()
 
+	go g.watchReady()
 	return s.Serve(lis)
 }
+
+// watchReady 所有配置的消费组均已运行时健康检查返回 SERVING, 否则返回 NOT_SERVING.
+func (g *Server) watchReady() {
+	ticker := time.NewTicker(readyInterval)
+	defer ticker.Stop()
+
+	for {
+		serving := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		if g.consumer.Ready() {
+			serving = grpc_health_v1.HealthCheckResponse_SERVING
+		}
+		g.health.SetServingStatus("", serving)
+
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop 停止接收新请求, 等待处理中的请求完成. 客户端订阅的长连接不会主动结束, 先关闭订阅.
+func (g *Server) Stop() {
+	g.mu.Lock()
+	s := g.server
+	select {
+	case <-g.done:
+	default:
+		close(g.done)
+	}
+	g.mu.Unlock()
+
+	// 停止前先让健康检查返回 NOT_SERVING, 负载均衡不再转发新请求.
+	g.health.Shutdown()
+	g.ConsumerGroupAPI.streams.Shutdown()
+
+	if s != nil {
+		s.GracefulStop()
+	}
+}
@@ -3,6 +3,7 @@ package inject
 import (
 	"github.com/linhoi/mq/iface/grpc"
 	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq"
 	"github.com/opentracing/opentracing-go"
 	"go.uber.org/zap"
 )
@@ -12,8 +13,10 @@ type App struct {
 	Logger     *zap.Logger
 	Tracer     opentracing.Tracer
 	GRPCServer *grpc.Server
+	Consumer   *rocketmq.Consumer
+	Reconciler *rocketmq.Reconciler
 }
 
-func NewApp(conf *config.Config, logger *zap.Logger, tracer opentracing.Tracer,GRPCServer *grpc.Server) *App {
-	return &App{Conf: conf, Logger: logger, Tracer: tracer, GRPCServer: GRPCServer}
+func NewApp(conf *config.Config, logger *zap.Logger, tracer opentracing.Tracer,GRPCServer *grpc.Server, consumer *rocketmq.Consumer, reconciler *rocketmq.Reconciler) *App {
+	return &App{Conf: conf, Logger: logger, Tracer: tracer, GRPCServer: GRPCServer, Consumer: consumer, Reconciler: reconciler}
 }
@@ -42,7 +42,15 @@ func tracer(conf *config.Config) (opentracing.Tracer, func()) {
 
 var provider = wire.NewSet(
 	rocketmq.NewProducer,
+	rocketmq.NewAdmin,
+	rocketmq.NewCallback,
+	rocketmq.NewConsumer,
+	rocketmq.NewOffsets,
+	rocketmq.NewReconciler,
+	rocketmq.NewStreams,
 	grpc.NewAPI,
+	grpc.NewAdminAPI,
+	grpc.NewConsumerGroupAPI,
 	grpc.NewServer,
 )
 
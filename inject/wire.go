@@ -9,6 +9,7 @@ import (
 
 func InitApp(env config.Env) (app *App, cleanup func(), err error) {
 	wire.Build(
+		config.NewWatcher,
 		config.New,
 		logger,
 		tracer,
@@ -14,7 +14,8 @@ import (
 // Injectors from wire.go:
 
 func InitApp(env config.Env) (*App, func(), error) {
-	configConfig := config.New(env)
+	watcher := config.NewWatcher()
+	configConfig := config.New(env, watcher)
 	zapLogger, cleanup, err := logger(configConfig)
 	if err != nil {
 		return nil, nil, err
@@ -27,9 +28,19 @@ func InitApp(env config.Env) (*App, func(), error) {
 		return nil, nil, err
 	}
 	api := grpc.NewAPI(producer)
-	server := grpc.NewServer(configConfig, api)
-	app := NewApp(configConfig, zapLogger, opentracingTracer, server)
+	admin := rocketmq.NewAdmin(configConfig)
+	callback := rocketmq.NewCallback()
+	consumer, cleanup4 := rocketmq.NewConsumer(configConfig, callback, producer)
+	offsets := rocketmq.NewOffsets(configConfig, admin, consumer)
+	adminAPI := grpc.NewAdminAPI(admin, offsets)
+	streams, cleanup5 := rocketmq.NewStreams(consumer)
+	consumerGroupAPI := grpc.NewConsumerGroupAPI(streams)
+	server := grpc.NewServer(configConfig, api, adminAPI, consumerGroupAPI, consumer)
+	reconciler := rocketmq.NewReconciler(configConfig, watcher, producer, consumer, admin)
+	app := NewApp(configConfig, zapLogger, opentracingTracer, server, consumer, reconciler)
 	return app, func() {
+		cleanup5()
+		cleanup4()
 		cleanup3()
 		cleanup2()
 		cleanup()
@@ -5,6 +5,8 @@ import (
 	"github.com/linhoi/mq/external/log"
 	"github.com/uber/jaeger-client-go/config"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Env string
@@ -28,6 +30,10 @@ type Server struct {
 type RocketMQ struct {
 	Instances []Instance
 	Consumers []Consumer
+	// OffsetStoreDir 广播模式消费位点的本地存储目录, 为空时使用 $HOME/.rocketmq_client_go.
+	// 需要用相同的环境变量 rocketmq.client.localOffsetStoreDir 启动, 如 env rocketmq.client.localOffsetStoreDir=dir app start,
+	// 不一致时启动失败.
+	OffsetStoreDir string
 }
 
 type Instance struct {
@@ -40,31 +46,333 @@ type Instance struct {
 	}
 }
 
+// 消费模式.
+const (
+	ModelClustering   = "clustering"
+	ModelBroadcasting = "broadcasting"
+)
+
 type Consumer struct {
 	GroupID     string
 	Instance    string
+	Model       string // clustering(默认) 或 broadcasting.
 	CallbackURL string
 	Targets     []Target
+	Batch       Batch
+	Retry       Retry
+	Flow        Flow
+	Breaker     Breaker
+	HTTP        HTTP
+	GRPC        GRPC
+	Transform   Transform
+	Idempotent  Idempotent
+	// Destinations 多个回调目标, 配置后忽略 callbackURL 与 http.
+	Destinations []Destination
+	// Routes 按消息内容选择回调目标, 都不匹配时使用 callbackURL 或 destinations.
+	Routes []Route
+}
+
+// Broadcasting 是否为广播消费, 广播模式下每个应用实例都会消费全部消息.
+func (c Consumer) Broadcasting() bool {
+	return c.Model == ModelBroadcasting
+}
+
+// Endpoints 返回消费组的回调目标, 未配置 destinations 时为 callbackURL.
+func (c Consumer) Endpoints() []Destination {
+	if len(c.Destinations) == 0 {
+		return []Destination{{Name: c.CallbackURL, CallbackURL: c.CallbackURL, Policy: DeliveryAll, HTTP: c.HTTP, GRPC: c.GRPC, Transform: c.Transform}}
+	}
+
+	endpoints := make([]Destination, len(c.Destinations))
+	for i, d := range c.Destinations {
+		if d.Name == "" {
+			d.Name = d.CallbackURL
+		}
+		if d.Policy == "" {
+			d.Policy = DeliveryAll
+		}
+		endpoints[i] = d
+	}
+	return endpoints
+}
+
+// 回调目标的成功策略.
+const (
+	DeliveryAll        = "all"        // 目标必须成功, 失败时重试.
+	DeliveryAny        = "any"        // 策略为 any 的目标中任一成功即可.
+	DeliveryBestEffort = "bestEffort" // 只投递一次, 失败不重试.
+)
+
+// Destination 消费组的一个回调目标, 每个目标的投递结果单独记录, 重试时跳过已成功的目标.
+type Destination struct {
+	Name        string // 为空时使用 callbackURL, 同一消费组内不能重复.
+	CallbackURL string
+	Policy      string // all(默认), any 或 bestEffort.
+	HTTP        HTTP
+	GRPC        GRPC
+	Transform   Transform
+}
+
+// Route 按顺序匹配的路由规则, 配置的条件同时满足时消息回调到该规则的 callbackURL.
+type Route struct {
+	Name        string   // 同一消费组内唯一, 不能与 destinations 重名.
+	Tags        []string // 消息 tag 为其中之一.
+	Keys        string   // 任一 key 匹配的 glob 模式, 如 order-*.
+	SQL         string   // 用户属性的 SQL92 表达式, 语法同 targets.sql.
+	CallbackURL string
+	HTTP        HTTP
+	GRPC        GRPC
+	Transform   Transform
+}
+
+// 幂等记录的存储.
+const (
+	IdempotentMemory = "memory"
+	IdempotentRedis  = "redis"
+	IdempotentGorm   = "gorm"
+)
+
+// Idempotent 消费幂等, 回调成功的消息在 TTL 内不再回调, 其他协程或实例处理中的重复消息稍后重试.
+// 存储不可用时消息按重试策略重试.
+type Idempotent struct {
+	Enable bool
+	Key    string        // msgId(默认), key(第一个业务主键) 或 property:<name>.
+	Store  string        // memory(默认, 只对本进程生效), redis 或 gorm.
+	TTL    time.Duration // 处理完成记录的保留时间, 默认 24h.
+	Lease  time.Duration // 处理中标记的有效期, 默认 1m, 应大于回调超时.
+	Size   int           // memory 存储的最大记录数, 默认 100000.
+	Redis  Redis
+	Gorm   Gorm
+}
+
+type Redis struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+type Gorm struct {
+	Dialect string // mysql(默认) 或 postgres.
+	DSN     string
+	Table   string // 默认 mq_idempotent, 不存在时自动创建.
+}
+
+// Transform 回调前转换消息, 转换失败的消息直接进入死信.
+// 模板可以引用 .Group .Topic .MsgID .Tags .Keys .Properties .BornTimestamp 与 .Body,
+// .Body 为 JSON 解析后的消息体, 不是 JSON 时为字符串, 模板函数 json 把值编码为 JSON.
+type Transform struct {
+	Fields   []FieldMapping    // 按 JSONPath 映射生成新的消息体.
+	Template string            // 模板生成的消息体, 与 fields 二选一.
+	Headers  map[string]string // 模板生成的请求头, gRPC 回调为 metadata.
+	Query    map[string]string // 模板生成的 query 参数, 只对 http 回调生效.
+}
+
+// FieldMapping 把回调消息中 From 路径的值写到新消息体的 To 路径, 不存在的字段为 null.
+// From 的字段名同 http 回调的消息, body 为 JSON 解析后的消息体, 如 from: $.body.orderId, to: order.id.
+type FieldMapping struct {
+	From string
+	To   string
+}
+
+// HTTP http 回调的请求配置.
+type HTTP struct {
+	Method string // 默认 PUT.
+	// Headers 请求头, 值为 text/template 模板, 可以引用 .Group .Topic .MsgID .Tags .Keys .Count
+	// 与 .Properties, 批量回调时为第一条消息的值.
+	Headers map[string]string
+	Timeout time.Duration // 默认 10s, 消息设置了 TTL 属性时不超过剩余存活时间.
+	TLS     TLS
+	Auth    Auth
+	Signing Signing
+	Success Success
+	// Ejection http+dns://, http+consul:// 与 http+static:// 回调连续失败的实例在冷却时间内不再选择.
+	Ejection Ejection
+}
+
+// Ejection 连接失败或状态码为 5xx 计为实例失败, 全部实例都被摘除时选择最早恢复的实例.
+type Ejection struct {
+	Failures int           // 连续失败次数, 默认 3.
+	Cooldown time.Duration // 摘除时间, 默认 30s.
+}
+
+// GRPC gRPC 回调的连接配置, 证书与 token 文件更新后自动重新加载.
+type GRPC struct {
+	Secure    bool   // 使用 TLS 连接, 配置了 tls 中的任一项时自动开启.
+	TLS       TLS    // 同 http.tls.
+	TokenFile string // 每次调用携带文件中的 bearer token, 需要 TLS.
 }
 
+// 内置的回调成功判断规则.
+const (
+	SuccessCode   = "code"   // 响应体为 JSON 且 code 为0, 不判断状态码.
+	SuccessStatus = "status" // 状态码为 2xx, 响应体可以为空或非 JSON.
+	SuccessREST   = "rest"   // 状态码为 2xx, 429 与 503 按 Retry-After 退避, 401/403/404/408 与其他 5xx 重试, 其他 4xx 丢弃.
+)
+
+// Success http 回调成功的判断规则, 在内置规则的基础上覆盖.
+type Success struct {
+	Profile string   // code(默认), status 或 rest.
+	Status  []string // 成功的状态码, 如 200, 2xx, 200-204.
+	// JSONPath 响应体中以 . 分隔的字段路径, 如 data.status, 值等于 Value 时成功.
+	JSONPath string
+	Value    string
+	// Outcomes 状态码对应的结果 success, retry, backoff, discard 或 deadLetter, 优先于 Status,
+	// 多个匹配时取范围最小的, 如 {"429": "backoff", "4xx": "discard", "5xx": "retry"}.
+	Outcomes map[string]string
+}
+
+// Signing 回调请求的 HMAC-SHA256 签名, 接收方使用 external/webhook 校验.
+type Signing struct {
+	// Secrets 签名使用的 secret, 最多两个, 轮换时同时配置新旧 secret, 为空时不签名.
+	Secrets []string
+}
+
+type TLS struct {
+	CAFile             string // 校验服务端证书的 CA, 为空时使用系统 CA.
+	CertFile           string // 客户端证书, 与 KeyFile 一起用于双向认证.
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// 回调的认证方式.
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthOAuth2 = "oauth2"
+)
+
+type Auth struct {
+	Type     string // bearer, basic 或 oauth2, 为空时不认证.
+	Token    string // bearer.
+	Username string // basic.
+	Password string // basic.
+	OAuth2   OAuth2
+}
+
+// OAuth2 client credentials 模式, token 缓存到过期前刷新.
+type OAuth2 struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Breaker 回调熔断, 错误率或慢调用比例超过阈值时暂停消费, 半开时放行少量探测消息.
+// 同一 callbackURL 的消费组共用一个熔断器, 使用先启动的消费组的配置.
+type Breaker struct {
+	Enable         bool
+	Window         time.Duration // 统计窗口, 默认 10s.
+	MinRequests    int           // 窗口内回调数达到该值才判断是否熔断, 默认 20.
+	ErrorRate      float64       // 错误率阈值, 默认 0.5.
+	SlowCall       time.Duration // 耗时超过该值为慢调用, 0 不统计慢调用.
+	SlowRate       float64       // 慢调用比例阈值, 默认 0.5.
+	OpenDuration   time.Duration // 熔断后暂停消费的时长, 之后进入半开, 默认 30s.
+	HalfOpenProbes int           // 半开时放行的探测回调数, 全部成功后恢复, 默认 3.
+}
+
+// Flow 消费并发与回调限流, 支持热更新.
+// ConsumeGoroutines 与 PullBatchSize 变更时重启消费组, 其余参数直接生效.
+type Flow struct {
+	ConsumeGoroutines int     // 消费协程数, 0 使用客户端默认值.
+	PullBatchSize     int32   // 单次拉取的消息数, 0 使用客户端默认值.
+	MaxInflight       int     // 同时进行中的回调数上限, 0 不限制.
+	Rate              float64 // 每秒回调次数上限, 0 不限制.
+}
+
+// Batch 批量回调, 开启后多条消息合并为一次 HTTP 或 gRPC 请求.
+type Batch struct {
+	Enable  bool
+	MaxSize int           // 单次回调最多携带的消息数.
+	Linger  time.Duration // 凑批的最长等待时间.
+}
+
+// Retry 消费失败的重试策略.
+type Retry struct {
+	MaxReconsumeTimes int32  // 最大重试次数, 超过后进入死信, 0 为 broker 默认的 16 次.
+	DelayLevels       []int  // 第 n 次重试使用的延迟级别, 超过长度时使用最后一个, 为空时由 broker 按 3+n 递增.
+	DeadLetter        string // 死信 topic, 为空时由 broker 投递到 %DLQ%groupID.
+}
+
+const defaultMaxReconsumeTimes = 16
+
+// MaxTimes 返回生效的最大重试次数.
+func (r Retry) MaxTimes() int32 {
+	if r.MaxReconsumeTimes > 0 {
+		return r.MaxReconsumeTimes
+	}
+	return defaultMaxReconsumeTimes
+}
+
+// DelayLevel 返回已重试 reconsumeTimes 次的消息下次重试的延迟级别, 0 表示由 broker 决定.
+func (r Retry) DelayLevel(reconsumeTimes int32) int {
+	if len(r.DelayLevels) == 0 {
+		return 0
+	}
+	if int(reconsumeTimes) < len(r.DelayLevels) {
+		return r.DelayLevels[reconsumeTimes]
+	}
+	return r.DelayLevels[len(r.DelayLevels)-1]
+}
+
+// Target 订阅的 topic, Tags 与 SQL 二选一. SQL 为基于消息属性的 SQL92 表达式,
+// 如 region = 'cn' AND amount > 100, 需要 broker 开启 enablePropertyFilter.
 type Target struct {
 	Topic string
 	Tags  []string
+	SQL   string
 }
 
 func (t Target) Expression() string {
+	if t.SQL != "" {
+		return t.SQL
+	}
 	if len(t.Tags) == 0 {
 		return "*"
 	}
 	return strings.Join(t.Tags, "||")
 }
 
-func New(env Env) *Config {
+func New(env Env, watcher *Watcher) *Config {
 	c := Config{}
-	err := conf.New(&c, conf.WithFile(string(env)))
+	err := conf.New(&c, conf.WithFile(string(env)), conf.WithOnChange(func() {
+		watcher.notify(&c)
+	}))
 	if err != nil {
 		panic(err.Error())
 	}
 
 	return &c
 }
+
+// Watcher 配置热更新通知, 回调在配置更新的协程中依次执行.
+type Watcher struct {
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+func NewWatcher() *Watcher {
+	return &Watcher{}
+}
+
+// Subscribe 注册配置更新后的回调.
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.listeners = append(w.listeners, fn)
+}
+
+func (w *Watcher) notify(c *Config) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	listeners := w.listeners
+	w.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(c)
+	}
+}
@@ -1,4 +1,8 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.17.3
+// source: mq.proto
 
 package mq
 
@@ -11,6 +15,7 @@ import (
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
 const _ = grpc.SupportPackageIsVersion7
 
 // ProducerAPIClient is the client API for ProducerAPI service.
@@ -64,7 +69,7 @@ type UnsafeProducerAPIServer interface {
 }
 
 func RegisterProducerAPIServer(s grpc.ServiceRegistrar, srv ProducerAPIServer) {
-	s.RegisterService(&_ProducerAPI_serviceDesc, srv)
+	s.RegisterService(&ProducerAPI_ServiceDesc, srv)
 }
 
 func _ProducerAPI_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -85,7 +90,10 @@ func _ProducerAPI_SendMessage_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
-var _ProducerAPI_serviceDesc = grpc.ServiceDesc{
+// ProducerAPI_ServiceDesc is the grpc.ServiceDesc for ProducerAPI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ProducerAPI_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "mq.ProducerAPI",
 	HandlerType: (*ProducerAPIServer)(nil),
 	Methods: []grpc.MethodDesc{
@@ -104,6 +112,8 @@ var _ProducerAPI_serviceDesc = grpc.ServiceDesc{
 type ConsumerAPIClient interface {
 	// RecvMessage.
 	RecvMessage(ctx context.Context, in *RecvMessageRequest, opts ...grpc.CallOption) (*RecvMessageResponse, error)
+	// RecvMessages 批量回调模式下一次推送多条消息.
+	RecvMessages(ctx context.Context, in *RecvMessagesRequest, opts ...grpc.CallOption) (*RecvMessagesResponse, error)
 }
 
 type consumerAPIClient struct {
@@ -123,12 +133,23 @@ func (c *consumerAPIClient) RecvMessage(ctx context.Context, in *RecvMessageRequ
 	return out, nil
 }
 
+func (c *consumerAPIClient) RecvMessages(ctx context.Context, in *RecvMessagesRequest, opts ...grpc.CallOption) (*RecvMessagesResponse, error) {
+	out := new(RecvMessagesResponse)
+	err := c.cc.Invoke(ctx, "/mq.ConsumerAPI/RecvMessages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ConsumerAPIServer is the server API for ConsumerAPI service.
 // All implementations must embed UnimplementedConsumerAPIServer
 // for forward compatibility
 type ConsumerAPIServer interface {
 	// RecvMessage.
 	RecvMessage(context.Context, *RecvMessageRequest) (*RecvMessageResponse, error)
+	// RecvMessages 批量回调模式下一次推送多条消息.
+	RecvMessages(context.Context, *RecvMessagesRequest) (*RecvMessagesResponse, error)
 	mustEmbedUnimplementedConsumerAPIServer()
 }
 
@@ -139,6 +160,9 @@ type UnimplementedConsumerAPIServer struct {
 func (UnimplementedConsumerAPIServer) RecvMessage(context.Context, *RecvMessageRequest) (*RecvMessageResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RecvMessage not implemented")
 }
+func (UnimplementedConsumerAPIServer) RecvMessages(context.Context, *RecvMessagesRequest) (*RecvMessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecvMessages not implemented")
+}
 func (UnimplementedConsumerAPIServer) mustEmbedUnimplementedConsumerAPIServer() {}
 
 // UnsafeConsumerAPIServer may be embedded to opt out of forward compatibility for this service.
@@ -149,7 +173,7 @@ type UnsafeConsumerAPIServer interface {
 }
 
 func RegisterConsumerAPIServer(s grpc.ServiceRegistrar, srv ConsumerAPIServer) {
-	s.RegisterService(&_ConsumerAPI_serviceDesc, srv)
+	s.RegisterService(&ConsumerAPI_ServiceDesc, srv)
 }
 
 func _ConsumerAPI_RecvMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -170,7 +194,28 @@ func _ConsumerAPI_RecvMessage_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
-var _ConsumerAPI_serviceDesc = grpc.ServiceDesc{
+func _ConsumerAPI_RecvMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecvMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConsumerAPIServer).RecvMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.ConsumerAPI/RecvMessages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConsumerAPIServer).RecvMessages(ctx, req.(*RecvMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ConsumerAPI_ServiceDesc is the grpc.ServiceDesc for ConsumerAPI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ConsumerAPI_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "mq.ConsumerAPI",
 	HandlerType: (*ConsumerAPIServer)(nil),
 	Methods: []grpc.MethodDesc{
@@ -178,6 +223,482 @@ var _ConsumerAPI_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RecvMessage",
 			Handler:    _ConsumerAPI_RecvMessage_Handler,
 		},
+		{
+			MethodName: "RecvMessages",
+			Handler:    _ConsumerAPI_RecvMessages_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "mq.proto",
+}
+
+// ConsumerGroupAPIClient is the client API for ConsumerGroupAPI service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ConsumerGroupAPIClient interface {
+	// Subscribe 订阅消费组, 服务端持续推送消息. 同一消费组的多个连接之间负载均衡,
+	// 每条消息需要在可见性超时内 Ack 或 Nack, 否则重新投递.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (ConsumerGroupAPI_SubscribeClient, error)
+	// Ack 确认消息已处理.
+	Ack(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error)
+	// Nack 消息处理失败, delay_seconds 为0时立即重新投递, 否则由 broker 延迟后重新投递.
+	Nack(ctx context.Context, in *NackRequest, opts ...grpc.CallOption) (*NackResponse, error)
+}
+
+type consumerGroupAPIClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConsumerGroupAPIClient(cc grpc.ClientConnInterface) ConsumerGroupAPIClient {
+	return &consumerGroupAPIClient{cc}
+}
+
+func (c *consumerGroupAPIClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (ConsumerGroupAPI_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ConsumerGroupAPI_ServiceDesc.Streams[0], "/mq.ConsumerGroupAPI/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &consumerGroupAPISubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ConsumerGroupAPI_SubscribeClient interface {
+	Recv() (*SubscribeResponse, error)
+	grpc.ClientStream
+}
+
+type consumerGroupAPISubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *consumerGroupAPISubscribeClient) Recv() (*SubscribeResponse, error) {
+	m := new(SubscribeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *consumerGroupAPIClient) Ack(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error) {
+	out := new(AckResponse)
+	err := c.cc.Invoke(ctx, "/mq.ConsumerGroupAPI/Ack", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consumerGroupAPIClient) Nack(ctx context.Context, in *NackRequest, opts ...grpc.CallOption) (*NackResponse, error) {
+	out := new(NackResponse)
+	err := c.cc.Invoke(ctx, "/mq.ConsumerGroupAPI/Nack", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConsumerGroupAPIServer is the server API for ConsumerGroupAPI service.
+// All implementations must embed UnimplementedConsumerGroupAPIServer
+// for forward compatibility
+type ConsumerGroupAPIServer interface {
+	// Subscribe 订阅消费组, 服务端持续推送消息. 同一消费组的多个连接之间负载均衡,
+	// 每条消息需要在可见性超时内 Ack 或 Nack, 否则重新投递.
+	Subscribe(*SubscribeRequest, ConsumerGroupAPI_SubscribeServer) error
+	// Ack 确认消息已处理.
+	Ack(context.Context, *AckRequest) (*AckResponse, error)
+	// Nack 消息处理失败, delay_seconds 为0时立即重新投递, 否则由 broker 延迟后重新投递.
+	Nack(context.Context, *NackRequest) (*NackResponse, error)
+	mustEmbedUnimplementedConsumerGroupAPIServer()
+}
+
+// UnimplementedConsumerGroupAPIServer must be embedded to have forward compatible implementations.
+type UnimplementedConsumerGroupAPIServer struct {
+}
+
+func (UnimplementedConsumerGroupAPIServer) Subscribe(*SubscribeRequest, ConsumerGroupAPI_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedConsumerGroupAPIServer) Ack(context.Context, *AckRequest) (*AckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ack not implemented")
+}
+func (UnimplementedConsumerGroupAPIServer) Nack(context.Context, *NackRequest) (*NackResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Nack not implemented")
+}
+func (UnimplementedConsumerGroupAPIServer) mustEmbedUnimplementedConsumerGroupAPIServer() {}
+
+// UnsafeConsumerGroupAPIServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ConsumerGroupAPIServer will
+// result in compilation errors.
+type UnsafeConsumerGroupAPIServer interface {
+	mustEmbedUnimplementedConsumerGroupAPIServer()
+}
+
+func RegisterConsumerGroupAPIServer(s grpc.ServiceRegistrar, srv ConsumerGroupAPIServer) {
+	s.RegisterService(&ConsumerGroupAPI_ServiceDesc, srv)
+}
+
+func _ConsumerGroupAPI_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConsumerGroupAPIServer).Subscribe(m, &consumerGroupAPISubscribeServer{stream})
+}
+
+type ConsumerGroupAPI_SubscribeServer interface {
+	Send(*SubscribeResponse) error
+	grpc.ServerStream
+}
+
+type consumerGroupAPISubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *consumerGroupAPISubscribeServer) Send(m *SubscribeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ConsumerGroupAPI_Ack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConsumerGroupAPIServer).Ack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.ConsumerGroupAPI/Ack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConsumerGroupAPIServer).Ack(ctx, req.(*AckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConsumerGroupAPI_Nack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConsumerGroupAPIServer).Nack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.ConsumerGroupAPI/Nack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConsumerGroupAPIServer).Nack(ctx, req.(*NackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ConsumerGroupAPI_ServiceDesc is the grpc.ServiceDesc for ConsumerGroupAPI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ConsumerGroupAPI_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mq.ConsumerGroupAPI",
+	HandlerType: (*ConsumerGroupAPIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Ack",
+			Handler:    _ConsumerGroupAPI_Ack_Handler,
+		},
+		{
+			MethodName: "Nack",
+			Handler:    _ConsumerGroupAPI_Nack_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ConsumerGroupAPI_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mq.proto",
+}
+
+// AdminAPIClient is the client API for AdminAPI service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminAPIClient interface {
+	// QueryMessageByID 按消息ID查询.
+	QueryMessageByID(ctx context.Context, in *QueryMessageByIDRequest, opts ...grpc.CallOption) (*QueryMessageResponse, error)
+	// QueryMessageByKey 按业务主键在时间范围内查询.
+	QueryMessageByKey(ctx context.Context, in *QueryMessageByKeyRequest, opts ...grpc.CallOption) (*QueryMessageResponse, error)
+	// QueryMessageByOffset 按队列位点范围查询.
+	QueryMessageByOffset(ctx context.Context, in *QueryMessageByOffsetRequest, opts ...grpc.CallOption) (*QueryMessageResponse, error)
+	// DescribeOffsets 查看消费组各队列的位点与堆积.
+	DescribeOffsets(ctx context.Context, in *DescribeOffsetsRequest, opts ...grpc.CallOption) (*DescribeOffsetsResponse, error)
+	// ResetOffsets 重置消费组在主题上的位点, 本进程中运行的该消费组会先停止, 重置后再启动.
+	ResetOffsets(ctx context.Context, in *ResetOffsetsRequest, opts ...grpc.CallOption) (*ResetOffsetsResponse, error)
+	// RouteMessage 查看样例消息在消费组中匹配的路由与回调目标, 不发送消息.
+	RouteMessage(ctx context.Context, in *RouteMessageRequest, opts ...grpc.CallOption) (*RouteMessageResponse, error)
+}
+
+type adminAPIClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminAPIClient(cc grpc.ClientConnInterface) AdminAPIClient {
+	return &adminAPIClient{cc}
+}
+
+func (c *adminAPIClient) QueryMessageByID(ctx context.Context, in *QueryMessageByIDRequest, opts ...grpc.CallOption) (*QueryMessageResponse, error) {
+	out := new(QueryMessageResponse)
+	err := c.cc.Invoke(ctx, "/mq.AdminAPI/QueryMessageByID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminAPIClient) QueryMessageByKey(ctx context.Context, in *QueryMessageByKeyRequest, opts ...grpc.CallOption) (*QueryMessageResponse, error) {
+	out := new(QueryMessageResponse)
+	err := c.cc.Invoke(ctx, "/mq.AdminAPI/QueryMessageByKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminAPIClient) QueryMessageByOffset(ctx context.Context, in *QueryMessageByOffsetRequest, opts ...grpc.CallOption) (*QueryMessageResponse, error) {
+	out := new(QueryMessageResponse)
+	err := c.cc.Invoke(ctx, "/mq.AdminAPI/QueryMessageByOffset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminAPIClient) DescribeOffsets(ctx context.Context, in *DescribeOffsetsRequest, opts ...grpc.CallOption) (*DescribeOffsetsResponse, error) {
+	out := new(DescribeOffsetsResponse)
+	err := c.cc.Invoke(ctx, "/mq.AdminAPI/DescribeOffsets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminAPIClient) ResetOffsets(ctx context.Context, in *ResetOffsetsRequest, opts ...grpc.CallOption) (*ResetOffsetsResponse, error) {
+	out := new(ResetOffsetsResponse)
+	err := c.cc.Invoke(ctx, "/mq.AdminAPI/ResetOffsets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminAPIClient) RouteMessage(ctx context.Context, in *RouteMessageRequest, opts ...grpc.CallOption) (*RouteMessageResponse, error) {
+	out := new(RouteMessageResponse)
+	err := c.cc.Invoke(ctx, "/mq.AdminAPI/RouteMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminAPIServer is the server API for AdminAPI service.
+// All implementations must embed UnimplementedAdminAPIServer
+// for forward compatibility
+type AdminAPIServer interface {
+	// QueryMessageByID 按消息ID查询.
+	QueryMessageByID(context.Context, *QueryMessageByIDRequest) (*QueryMessageResponse, error)
+	// QueryMessageByKey 按业务主键在时间范围内查询.
+	QueryMessageByKey(context.Context, *QueryMessageByKeyRequest) (*QueryMessageResponse, error)
+	// QueryMessageByOffset 按队列位点范围查询.
+	QueryMessageByOffset(context.Context, *QueryMessageByOffsetRequest) (*QueryMessageResponse, error)
+	// DescribeOffsets 查看消费组各队列的位点与堆积.
+	DescribeOffsets(context.Context, *DescribeOffsetsRequest) (*DescribeOffsetsResponse, error)
+	// ResetOffsets 重置消费组在主题上的位点, 本进程中运行的该消费组会先停止, 重置后再启动.
+	ResetOffsets(context.Context, *ResetOffsetsRequest) (*ResetOffsetsResponse, error)
+	// RouteMessage 查看样例消息在消费组中匹配的路由与回调目标, 不发送消息.
+	RouteMessage(context.Context, *RouteMessageRequest) (*RouteMessageResponse, error)
+	mustEmbedUnimplementedAdminAPIServer()
+}
+
+// UnimplementedAdminAPIServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminAPIServer struct {
+}
+
+func (UnimplementedAdminAPIServer) QueryMessageByID(context.Context, *QueryMessageByIDRequest) (*QueryMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryMessageByID not implemented")
+}
+func (UnimplementedAdminAPIServer) QueryMessageByKey(context.Context, *QueryMessageByKeyRequest) (*QueryMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryMessageByKey not implemented")
+}
+func (UnimplementedAdminAPIServer) QueryMessageByOffset(context.Context, *QueryMessageByOffsetRequest) (*QueryMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryMessageByOffset not implemented")
+}
+func (UnimplementedAdminAPIServer) DescribeOffsets(context.Context, *DescribeOffsetsRequest) (*DescribeOffsetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeOffsets not implemented")
+}
+func (UnimplementedAdminAPIServer) ResetOffsets(context.Context, *ResetOffsetsRequest) (*ResetOffsetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetOffsets not implemented")
+}
+func (UnimplementedAdminAPIServer) RouteMessage(context.Context, *RouteMessageRequest) (*RouteMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RouteMessage not implemented")
+}
+func (UnimplementedAdminAPIServer) mustEmbedUnimplementedAdminAPIServer() {}
+
+// UnsafeAdminAPIServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminAPIServer will
+// result in compilation errors.
+type UnsafeAdminAPIServer interface {
+	mustEmbedUnimplementedAdminAPIServer()
+}
+
+func RegisterAdminAPIServer(s grpc.ServiceRegistrar, srv AdminAPIServer) {
+	s.RegisterService(&AdminAPI_ServiceDesc, srv)
+}
+
+func _AdminAPI_QueryMessageByID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryMessageByIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminAPIServer).QueryMessageByID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.AdminAPI/QueryMessageByID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminAPIServer).QueryMessageByID(ctx, req.(*QueryMessageByIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminAPI_QueryMessageByKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryMessageByKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminAPIServer).QueryMessageByKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.AdminAPI/QueryMessageByKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminAPIServer).QueryMessageByKey(ctx, req.(*QueryMessageByKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminAPI_QueryMessageByOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryMessageByOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminAPIServer).QueryMessageByOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.AdminAPI/QueryMessageByOffset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminAPIServer).QueryMessageByOffset(ctx, req.(*QueryMessageByOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminAPI_DescribeOffsets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeOffsetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminAPIServer).DescribeOffsets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.AdminAPI/DescribeOffsets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminAPIServer).DescribeOffsets(ctx, req.(*DescribeOffsetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminAPI_ResetOffsets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetOffsetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminAPIServer).ResetOffsets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.AdminAPI/ResetOffsets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminAPIServer).ResetOffsets(ctx, req.(*ResetOffsetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminAPI_RouteMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RouteMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminAPIServer).RouteMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mq.AdminAPI/RouteMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminAPIServer).RouteMessage(ctx, req.(*RouteMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminAPI_ServiceDesc is the grpc.ServiceDesc for AdminAPI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdminAPI_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mq.AdminAPI",
+	HandlerType: (*AdminAPIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueryMessageByID",
+			Handler:    _AdminAPI_QueryMessageByID_Handler,
+		},
+		{
+			MethodName: "QueryMessageByKey",
+			Handler:    _AdminAPI_QueryMessageByKey_Handler,
+		},
+		{
+			MethodName: "QueryMessageByOffset",
+			Handler:    _AdminAPI_QueryMessageByOffset_Handler,
+		},
+		{
+			MethodName: "DescribeOffsets",
+			Handler:    _AdminAPI_DescribeOffsets_Handler,
+		},
+		{
+			MethodName: "ResetOffsets",
+			Handler:    _AdminAPI_ResetOffsets_Handler,
+		},
+		{
+			MethodName: "RouteMessage",
+			Handler:    _AdminAPI_RouteMessage_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "mq.proto",
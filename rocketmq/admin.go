@@ -0,0 +1,261 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq/admin"
+	"github.com/linhoi/mq/rocketmq/filter"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 消息在消费组上的消费状态.
+const (
+	StatusConsumed         = "CONSUMED"
+	StatusNotConsumedYet   = "NOT_CONSUMED_YET"
+	StatusConsumedFiltered = "CONSUMED_BUT_FILTERED"
+	StatusNoOffset         = "NO_OFFSET"
+	StatusUnknown          = "UNKNOWN"
+)
+
+const defaultQueryMax = 64
+
+// ErrInvalidQuery 查询参数不合法.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Admin 运维查询, 按实例直接访问 nameserver 与 broker.
+type Admin struct {
+	conf    *config.Config
+	mu      sync.Mutex
+	clients map[string]*admin.Client
+}
+
+func NewAdmin(conf *config.Config) *Admin {
+	a := &Admin{conf: conf}
+	a.setInstances(conf.RocketMQ.Instances)
+	return a
+}
+
+// setInstances 按实例配置重建管理客户端, 配置热更新成功后调用.
+func (a *Admin) setInstances(instances []config.Instance) {
+	clients := make(map[string]*admin.Client, len(instances))
+	for _, ins := range instances {
+		clients[ins.Name] = admin.New(ins.NameServer, primitive.Credentials{
+			AccessKey: ins.Credentials.AccessKey,
+			SecretKey: ins.Credentials.SecretKey,
+		})
+	}
+
+	a.mu.Lock()
+	a.clients = clients
+	a.mu.Unlock()
+}
+
+type ConsumeStatus struct {
+	Group          string `json:"group"`
+	Status         string `json:"status"`
+	ConsumerOffset int64  `json:"consumerOffset"`
+}
+
+type MessageView struct {
+	MsgID           string            `json:"msgId"`
+	OffsetMsgID     string            `json:"offsetMsgId"`
+	Topic           string            `json:"topic"`
+	Tags            string            `json:"tags"`
+	Keys            []string          `json:"keys"`
+	Properties      map[string]string `json:"properties"`
+	Body            string            `json:"body"`
+	BornHost        string            `json:"bornHost"`
+	BornTimestamp   int64             `json:"bornTimestamp"`
+	StoreHost       string            `json:"storeHost"`
+	StoreTimestamp  int64             `json:"storeTimestamp"`
+	Broker          string            `json:"broker"`
+	QueueID         int               `json:"queueId"`
+	QueueOffset     int64             `json:"queueOffset"`
+	ReconsumeTimes  int32             `json:"reconsumeTimes"`
+	ConsumeStatuses []ConsumeStatus   `json:"consumeStatuses"`
+}
+
+// QueryByID 按 msgId 查询, msgId 为 UNIQ_KEY 时必须提供 topic.
+func (a *Admin) QueryByID(ctx context.Context, instance, topic, msgID string, groups []string) ([]*MessageView, error) {
+	cli, err := a.client(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := cli.ViewMessage(ctx, topic, msgID)
+	if err != nil {
+		return nil, err
+	}
+	return a.views(ctx, instance, cli, []*primitive.MessageExt{msg}, groups), nil
+}
+
+// QueryByKey 按业务主键在 [begin, end] 时间范围内查询.
+func (a *Admin) QueryByKey(ctx context.Context, instance, topic, key string, begin, end time.Time, max int, groups []string) ([]*MessageView, error) {
+	cli, err := a.client(instance)
+	if err != nil {
+		return nil, err
+	}
+	if topic == "" || key == "" {
+		return nil, errors.New("topic and key are required")
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if max <= 0 {
+		max = defaultQueryMax
+	}
+
+	msgs, err := cli.QueryMessageByKey(ctx, topic, key, max, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return a.views(ctx, instance, cli, msgs, groups), nil
+}
+
+// QueryByOffset 按队列的 [begin, end) 位点范围查询.
+func (a *Admin) QueryByOffset(ctx context.Context, instance, topic, broker string, queueID int, begin, end int64, groups []string) ([]*MessageView, error) {
+	cli, err := a.client(instance)
+	if err != nil {
+		return nil, err
+	}
+	if topic == "" {
+		return nil, errors.Wrap(ErrInvalidQuery, "topic is required")
+	}
+	if end <= begin {
+		end = begin + 1
+	}
+	if end-begin > admin.MaxPullRange {
+		return nil, errors.Wrapf(ErrInvalidQuery, "offset range [%d, %d) exceeds %d, query in pages", begin, end, admin.MaxPullRange)
+	}
+
+	msgs, err := cli.PullMessages(ctx, primitive.MessageQueue{Topic: topic, BrokerName: broker, QueueId: queueID}, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return a.views(ctx, instance, cli, msgs, groups), nil
+}
+
+func (a *Admin) client(instance string) (*admin.Client, error) {
+	a.mu.Lock()
+	cli, ok := a.clients[getInstance(instance)]
+	a.mu.Unlock()
+	if ok {
+		return cli, nil
+	}
+	return nil, errors.Errorf("instance %s not found", getInstance(instance))
+}
+
+func (a *Admin) views(ctx context.Context, instance string, cli *admin.Client, msgs []*primitive.MessageExt, groups []string) []*MessageView {
+	views := make([]*MessageView, 0, len(msgs))
+	for _, msg := range msgs {
+		view := &MessageView{
+			MsgID:          msg.MsgId,
+			OffsetMsgID:    msg.OffsetMsgId,
+			Topic:          msg.Topic,
+			Tags:           msg.GetProperty(admin.PropertyTags),
+			Keys:           strings.Fields(msg.GetProperty(admin.PropertyKeys)),
+			Properties:     msg.GetProperties(),
+			Body:           string(msg.Body),
+			BornHost:       msg.BornHost,
+			BornTimestamp:  msg.BornTimestamp,
+			StoreHost:      msg.StoreHost,
+			StoreTimestamp: msg.StoreTimestamp,
+			QueueOffset:    msg.QueueOffset,
+			ReconsumeTimes: msg.ReconsumeTimes,
+		}
+		if msg.Queue != nil {
+			view.Broker = msg.Queue.BrokerName
+			view.QueueID = msg.Queue.QueueId
+		}
+
+		for _, group := range a.groups(instance, msg.Topic, groups) {
+			view.ConsumeStatuses = append(view.ConsumeStatuses, a.consumeStatus(ctx, cli, group, msg))
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// groups 返回配置中订阅了 topic 的消费组, 以及调用方额外指定的消费组.
+func (a *Admin) groups(instance, topic string, extra []string) []string {
+	seen := make(map[string]bool)
+	var groups []string
+	for _, c := range a.conf.RocketMQ.Consumers {
+		if getInstance(c.Instance) != getInstance(instance) || seen[c.GroupID] {
+			continue
+		}
+		for _, t := range c.Targets {
+			if t.Topic == topic {
+				seen[c.GroupID] = true
+				groups = append(groups, c.GroupID)
+				break
+			}
+		}
+	}
+	for _, g := range extra {
+		if !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func (a *Admin) consumeStatus(ctx context.Context, cli *admin.Client, group string, msg *primitive.MessageExt) ConsumeStatus {
+	status := ConsumeStatus{Group: group, Status: StatusUnknown}
+	if msg.Queue == nil {
+		return status
+	}
+
+	offset, err := cli.ConsumerOffset(ctx, group, *msg.Queue)
+	if admin.IsNotFound(err) {
+		status.Status = StatusNoOffset
+		return status
+	}
+	if err != nil {
+		return status
+	}
+
+	status.ConsumerOffset = offset
+	switch {
+	case offset <= msg.QueueOffset:
+		status.Status = StatusNotConsumedYet
+	case a.filtered(group, msg):
+		status.Status = StatusConsumedFiltered
+	default:
+		status.Status = StatusConsumed
+	}
+	return status
+}
+
+// filtered 判断消息是否被消费组的 tag 或 SQL92 订阅过滤.
+func (a *Admin) filtered(group string, msg *primitive.MessageExt) bool {
+	for _, c := range a.conf.RocketMQ.Consumers {
+		if c.GroupID != group {
+			continue
+		}
+		for _, t := range c.Targets {
+			if t.Topic != msg.Topic {
+				continue
+			}
+			if t.SQL != "" {
+				expr, err := filter.Parse(t.SQL)
+				return err == nil && !expr.Match(msg.GetProperties())
+			}
+			if len(t.Tags) == 0 {
+				continue
+			}
+			for _, tag := range t.Tags {
+				if tag == msg.GetProperty(admin.PropertyTags) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
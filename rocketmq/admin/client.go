@@ -0,0 +1,452 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	masterID = "0"
+
+	// toolsGroup 管理工具拉取消息时使用的消费组, 不提交位点.
+	toolsGroup = "TOOLS_CONSUMER"
+
+	// MaxPullRange 一次按位点拉取的最大范围, 避免把整个队列读入内存.
+	MaxPullRange = 256
+)
+
+// Client 基于 remoting 协议直接访问 nameserver 与 broker 的管理客户端.
+// rocketmq-client-go 未提供消息查询与位点管理接口, 这里按需实现.
+type Client struct {
+	nameServer  string
+	credentials primitive.Credentials
+	httpClient  *http.Client
+}
+
+// New nameServer 可以是 http(s) 寻址地址, 也可以是以 ; 分隔的 nameserver 列表.
+func New(nameServer string, credentials primitive.Credentials) *Client {
+	return &Client{
+		nameServer:  nameServer,
+		credentials: credentials,
+		httpClient:  &http.Client{Timeout: defaultInvokeTimeout},
+	}
+}
+
+type brokerData struct {
+	Cluster     string            `json:"cluster"`
+	BrokerName  string            `json:"brokerName"`
+	BrokerAddrs map[string]string `json:"brokerAddrs"`
+}
+
+type queueData struct {
+	BrokerName     string `json:"brokerName"`
+	ReadQueueNums  int    `json:"readQueueNums"`
+	WriteQueueNums int    `json:"writeQueueNums"`
+}
+
+type topicRoute struct {
+	BrokerDatas []brokerData `json:"brokerDatas"`
+	QueueDatas  []queueData  `json:"queueDatas"`
+}
+
+// masters 返回 brokerName 到 master 地址的映射.
+func (r *topicRoute) masters() map[string]string {
+	addrs := make(map[string]string)
+	for _, b := range r.BrokerDatas {
+		if addr, ok := b.BrokerAddrs[masterID]; ok {
+			addrs[b.BrokerName] = addr
+		}
+	}
+	return addrs
+}
+
+// Queues 返回 topic 所有可读队列.
+func (r *topicRoute) queues(topic string) []primitive.MessageQueue {
+	var mqs []primitive.MessageQueue
+	for _, q := range r.QueueDatas {
+		for i := 0; i < q.ReadQueueNums; i++ {
+			mqs = append(mqs, primitive.MessageQueue{Topic: topic, BrokerName: q.BrokerName, QueueId: i})
+		}
+	}
+	sort.Slice(mqs, func(i, j int) bool {
+		if mqs[i].BrokerName != mqs[j].BrokerName {
+			return mqs[i].BrokerName < mqs[j].BrokerName
+		}
+		return mqs[i].QueueId < mqs[j].QueueId
+	})
+	return mqs
+}
+
+// fastjson 会把 map 的数字 key 序列化为不带引号的形式, 如 {0:"127.0.0.1:10911"}.
+var numericKey = regexp.MustCompile(`([{,])\s*(\d+)\s*:`)
+
+func (c *Client) nameServers(ctx context.Context) ([]string, error) {
+	if !strings.HasPrefix(c.nameServer, "http://") && !strings.HasPrefix(c.nameServer, "https://") {
+		return splitAddrs(c.nameServer), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.nameServer, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return splitAddrs(string(body)), nil
+}
+
+func splitAddrs(s string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(strings.TrimSpace(s), ";") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func (c *Client) route(ctx context.Context, topic string) (*topicRoute, error) {
+	addrs, err := c.nameServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.Errorf("no nameserver available in %s", c.nameServer)
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		resp, err := invoke(ctx, addr, newCommand(reqGetRouteInfoByTopic, map[string]string{"topic": topic}), c.credentials)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Code != resSuccess {
+			return nil, newRemotingError(resp)
+		}
+
+		route := &topicRoute{}
+		if err := json.Unmarshal(numericKey.ReplaceAll(resp.Body, []byte(`$1"$2":`)), route); err != nil {
+			return nil, errors.Wrapf(err, "decode route of %s", topic)
+		}
+		return route, nil
+	}
+
+	return nil, lastErr
+}
+
+// ViewMessage 按 msgId 查询消息. msgId 可以是 offsetMsgId, 也可以是客户端生成的 UNIQ_KEY,
+// 后者需要提供 topic.
+func (c *Client) ViewMessage(ctx context.Context, topic, msgID string) (*primitive.MessageExt, error) {
+	if id, err := parseOffsetMsgID(msgID); err == nil {
+		resp, err := invoke(ctx, id.addr, newCommand(reqViewMessageByID, map[string]string{
+			"offset": strconv.FormatInt(id.offset, 10),
+		}), c.credentials)
+		if err == nil && resp.Code == resSuccess {
+			msgs, err := decodeMessages(resp.Body)
+			if err == nil && len(msgs) > 0 {
+				return c.withBroker(ctx, msgs[0])
+			}
+		}
+	}
+
+	if topic == "" {
+		return nil, errors.Errorf("message %s not found by offset msgId, topic is required to query by unique key", msgID)
+	}
+
+	msgs, err := c.queryMessage(ctx, topic, msgID, 32, time.Time{}, time.Now(), true)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.MsgId == msgID {
+			return msg, nil
+		}
+	}
+
+	return nil, errors.WithStack(&remotingError{Code: resQueryNotFound, Remark: "message " + msgID + " not found"})
+}
+
+// QueryMessageByKey 按业务主键在时间范围内查询消息.
+func (c *Client) QueryMessageByKey(ctx context.Context, topic, key string, max int, begin, end time.Time) ([]*primitive.MessageExt, error) {
+	msgs, err := c.queryMessage(ctx, topic, key, max, begin, end, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 索引按 hash 存储, 需要过滤掉 hash 冲突的消息.
+	var matched []*primitive.MessageExt
+	for _, msg := range msgs {
+		for _, k := range strings.Fields(msg.GetProperty(PropertyKeys)) {
+			if k == key {
+				matched = append(matched, msg)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+func (c *Client) queryMessage(ctx context.Context, topic, key string, max int, begin, end time.Time, uniq bool) ([]*primitive.MessageExt, error) {
+	route, err := c.route(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*primitive.MessageExt
+	for brokerName, addr := range route.masters() {
+		ext := map[string]string{
+			"topic":          topic,
+			"key":            key,
+			"maxNum":         strconv.Itoa(max),
+			"beginTimestamp": strconv.FormatInt(millis(begin), 10),
+			"endTimestamp":   strconv.FormatInt(millis(end), 10),
+		}
+		if uniq {
+			ext["_UNIQUE_KEY_QUERY"] = "true"
+		}
+
+		resp, err := invoke(ctx, addr, newCommand(reqQueryMessage, ext), c.credentials)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Code == resQueryNotFound {
+			continue
+		}
+		if resp.Code != resSuccess {
+			return nil, newRemotingError(resp)
+		}
+
+		found, err := decodeMessages(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range found {
+			msg.Queue.BrokerName = brokerName
+		}
+		msgs = append(msgs, found...)
+	}
+
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].StoreTimestamp < msgs[j].StoreTimestamp })
+	return msgs, nil
+}
+
+// PullMessages 从指定队列的 [begin, end) 位点范围内拉取消息, 不提交消费位点.
+func (c *Client) PullMessages(ctx context.Context, mq primitive.MessageQueue, begin, end int64) ([]*primitive.MessageExt, error) {
+	if end-begin > MaxPullRange {
+		return nil, errors.Errorf("offset range [%d, %d) exceeds %d", begin, end, MaxPullRange)
+	}
+
+	addr, err := c.brokerAddr(ctx, mq.Topic, mq.BrokerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*primitive.MessageExt
+	for offset := begin; offset < end; {
+		num := end - offset
+		if num > 32 {
+			num = 32
+		}
+
+		resp, err := invoke(ctx, addr, newCommand(reqPullMessage, map[string]string{
+			"consumerGroup":        toolsGroup,
+			"topic":                mq.Topic,
+			"queueId":              strconv.Itoa(mq.QueueId),
+			"queueOffset":          strconv.FormatInt(offset, 10),
+			"maxMsgNums":           strconv.FormatInt(num, 10),
+			"sysFlag":              "0",
+			"commitOffset":         "0",
+			"suspendTimeoutMillis": "0",
+			"subscription":         "*",
+			"subVersion":           "0",
+			"expressionType":       "TAG",
+		}), c.credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.Code {
+		case resSuccess:
+		case resPullNotFound, resPullOffsetMoved, resPullRetryImmediately:
+			return msgs, nil
+		default:
+			return nil, newRemotingError(resp)
+		}
+
+		found, err := decodeMessages(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return msgs, nil
+		}
+		for _, msg := range found {
+			if msg.QueueOffset >= end {
+				return msgs, nil
+			}
+			msg.Queue.BrokerName = mq.BrokerName
+			msgs = append(msgs, msg)
+		}
+
+		next, err := strconv.ParseInt(resp.ExtFields["nextBeginOffset"], 10, 64)
+		if err != nil || next <= offset {
+			return msgs, nil
+		}
+		offset = next
+	}
+
+	return msgs, nil
+}
+
+// ConsumerOffset 查询消费组在队列上已提交的位点, 消费组从未提交过时返回 IsNotFound 错误.
+func (c *Client) ConsumerOffset(ctx context.Context, group string, mq primitive.MessageQueue) (int64, error) {
+	addr, err := c.brokerAddr(ctx, mq.Topic, mq.BrokerName)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := invoke(ctx, addr, newCommand(reqQueryConsumerOffset, map[string]string{
+		"consumerGroup": group,
+		"topic":         mq.Topic,
+		"queueId":       strconv.Itoa(mq.QueueId),
+	}), c.credentials)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Code != resSuccess {
+		return 0, newRemotingError(resp)
+	}
+
+	return strconv.ParseInt(resp.ExtFields["offset"], 10, 64)
+}
+
+// UpdateConsumerOffset 更新消费组在队列上的位点, 消费组在线时会被客户端的位点提交覆盖.
+func (c *Client) UpdateConsumerOffset(ctx context.Context, group string, mq primitive.MessageQueue, offset int64) error {
+	addr, err := c.brokerAddr(ctx, mq.Topic, mq.BrokerName)
+	if err != nil {
+		return err
+	}
+
+	resp, err := invoke(ctx, addr, newCommand(reqUpdateConsumerOffset, map[string]string{
+		"consumerGroup": group,
+		"topic":         mq.Topic,
+		"queueId":       strconv.Itoa(mq.QueueId),
+		"commitOffset":  strconv.FormatInt(offset, 10),
+	}), c.credentials)
+	if err != nil {
+		return err
+	}
+	if resp.Code != resSuccess {
+		return newRemotingError(resp)
+	}
+	return nil
+}
+
+// MinOffset 返回队列的最小位点.
+func (c *Client) MinOffset(ctx context.Context, mq primitive.MessageQueue) (int64, error) {
+	return c.queueOffset(ctx, reqGetMinOffset, mq, nil)
+}
+
+// MaxOffset 返回队列的最大位点, 即下一条消息的位点.
+func (c *Client) MaxOffset(ctx context.Context, mq primitive.MessageQueue) (int64, error) {
+	return c.queueOffset(ctx, reqGetMaxOffset, mq, nil)
+}
+
+// SearchOffset 返回队列中存储时间不早于 t 的第一条消息的位点.
+func (c *Client) SearchOffset(ctx context.Context, mq primitive.MessageQueue, t time.Time) (int64, error) {
+	return c.queueOffset(ctx, reqSearchOffsetByTimestamp, mq, map[string]string{
+		"timestamp": strconv.FormatInt(millis(t), 10),
+	})
+}
+
+func (c *Client) queueOffset(ctx context.Context, code int, mq primitive.MessageQueue, ext map[string]string) (int64, error) {
+	addr, err := c.brokerAddr(ctx, mq.Topic, mq.BrokerName)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := map[string]string{
+		"topic":   mq.Topic,
+		"queueId": strconv.Itoa(mq.QueueId),
+	}
+	for k, v := range ext {
+		fields[k] = v
+	}
+
+	resp, err := invoke(ctx, addr, newCommand(code, fields), c.credentials)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Code != resSuccess {
+		return 0, newRemotingError(resp)
+	}
+
+	return strconv.ParseInt(resp.ExtFields["offset"], 10, 64)
+}
+
+// Queues 返回 topic 的所有可读队列.
+func (c *Client) Queues(ctx context.Context, topic string) ([]primitive.MessageQueue, error) {
+	route, err := c.route(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	return route.queues(topic), nil
+}
+
+func (c *Client) brokerAddr(ctx context.Context, topic, brokerName string) (string, error) {
+	route, err := c.route(ctx, topic)
+	if err != nil {
+		return "", err
+	}
+
+	masters := route.masters()
+	if brokerName == "" && len(masters) == 1 {
+		for _, addr := range masters {
+			return addr, nil
+		}
+	}
+	if addr, ok := masters[brokerName]; ok {
+		return addr, nil
+	}
+	return "", errors.Errorf("broker %q of topic %s not found", brokerName, topic)
+}
+
+// withBroker 通过 storeHost 反查消息所在的 brokerName.
+func (c *Client) withBroker(ctx context.Context, msg *primitive.MessageExt) (*primitive.MessageExt, error) {
+	route, err := c.route(ctx, msg.Topic)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range route.BrokerDatas {
+		for _, addr := range b.BrokerAddrs {
+			if addr == msg.StoreHost {
+				msg.Queue.BrokerName = b.BrokerName
+			}
+		}
+	}
+	return msg, nil
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
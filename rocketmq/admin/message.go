@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	flagCompressed  = 0x1
+	flagBornHostV6  = 0x1 << 4
+	flagStoreHostV6 = 0x1 << 5
+
+	nameValueSeparator = "\u0001"
+	propertySeparator  = "\u0002"
+
+	// PropertyUniqKey 客户端生成的消息ID.
+	PropertyUniqKey = "UNIQ_KEY"
+	// PropertyKeys 业务主键, 多个以空格分隔.
+	PropertyKeys = "KEYS"
+	// PropertyTags 消息标签.
+	PropertyTags = "TAGS"
+)
+
+// decodeMessages 解码 broker 存储格式的消息列表, 与 MessageDecoder.decodes 对应.
+func decodeMessages(data []byte) ([]*primitive.MessageExt, error) {
+	var msgs []*primitive.MessageExt
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		msg, err := decodeMessage(r)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// decoder 顺序读取消息字段, 出错后后续读取直接返回第一次的错误.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) read(v interface{}) error {
+	if d.err == nil {
+		if err := binary.Read(d.r, binary.BigEndian, v); err != nil {
+			d.err = errors.Wrap(err, "decode message")
+		}
+	}
+	return d.err
+}
+
+// readBytes 读取 n 个字节, n 超过剩余长度时不分配直接返回错误.
+func (d *decoder) readBytes(n int) ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if n < 0 || n > d.r.Len() {
+		d.err = errors.Errorf("decode message: length %d exceeds remaining %d bytes", n, d.r.Len())
+		return nil, d.err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = errors.Wrap(err, "decode message")
+	}
+	return b, d.err
+}
+
+func (d *decoder) readHost(v6 bool) string {
+	n := net.IPv4len
+	if v6 {
+		n = net.IPv6len
+	}
+	ip, _ := d.readBytes(n)
+	var port int32
+	if d.read(&port) != nil {
+		return ""
+	}
+	return net.JoinHostPort(net.IP(ip).String(), strconv.Itoa(int(port)))
+}
+
+// offset 已读取的字节数.
+func (d *decoder) offset() int64 {
+	return d.r.Size() - int64(d.r.Len())
+}
+
+func decodeMessage(r *bytes.Reader) (*primitive.MessageExt, error) {
+	var (
+		magicCode int32
+		queueID   int32
+		bodyLen   int32
+		topicLen  uint8
+		propsLen  int16
+	)
+
+	msg := &primitive.MessageExt{}
+	d := &decoder{r: r}
+	d.read(&msg.StoreSize)
+	d.read(&magicCode)
+	d.read(&msg.BodyCRC)
+	d.read(&queueID)
+	d.read(&msg.Flag)
+	d.read(&msg.QueueOffset)
+	d.read(&msg.CommitLogOffset)
+	d.read(&msg.SysFlag)
+	d.read(&msg.BornTimestamp)
+	msg.BornHost = d.readHost(msg.SysFlag&flagBornHostV6 != 0)
+	d.read(&msg.StoreTimestamp)
+	storeHostStart := d.offset()
+	msg.StoreHost = d.readHost(msg.SysFlag&flagStoreHostV6 != 0)
+	storeHostEnd := d.offset()
+	d.read(&msg.ReconsumeTimes)
+	d.read(&msg.PreparedTransactionOffset)
+
+	if d.read(&bodyLen) == nil && bodyLen > 0 {
+		msg.Body, _ = d.readBytes(int(bodyLen))
+	}
+
+	if d.read(&topicLen) == nil {
+		topic, _ := d.readBytes(int(topicLen))
+		msg.Topic = string(topic)
+	}
+
+	if d.read(&propsLen) == nil && propsLen > 0 {
+		if props, err := d.readBytes(int(propsLen)); err == nil {
+			msg.WithProperties(decodeProperties(string(props)))
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	// offsetMsgId = storeHost(ip+port) + commitLogOffset.
+	storeHost := make([]byte, storeHostEnd-storeHostStart)
+	_, _ = r.ReadAt(storeHost, storeHostStart)
+	offset := make([]byte, 8)
+	binary.BigEndian.PutUint64(offset, uint64(msg.CommitLogOffset))
+	msg.OffsetMsgId = strings.ToUpper(hex.EncodeToString(append(storeHost, offset...)))
+
+	if msg.SysFlag&flagCompressed != 0 {
+		zr, err := zlib.NewReader(bytes.NewReader(msg.Body))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		msg.Body, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	msg.Queue = &primitive.MessageQueue{Topic: msg.Topic, QueueId: int(queueID)}
+	msg.MsgId = msg.GetProperty(PropertyUniqKey)
+	if msg.MsgId == "" {
+		msg.MsgId = msg.OffsetMsgId
+	}
+	return msg, nil
+}
+
+func decodeProperties(s string) map[string]string {
+	props := make(map[string]string)
+	for _, kv := range strings.Split(s, propertySeparator) {
+		pair := strings.SplitN(kv, nameValueSeparator, 2)
+		if len(pair) == 2 {
+			props[pair[0]] = pair[1]
+		}
+	}
+	return props
+}
+
+// offsetMsgID 是从 offsetMsgId 中解析出的 broker 地址与物理偏移.
+type offsetMsgID struct {
+	addr   string
+	offset int64
+}
+
+// parseOffsetMsgID 解析 broker 生成的 offsetMsgId, 与客户端生成的 UNIQ_KEY 长度相同,
+// 无法仅凭格式区分, 解析失败或查询失败时需再按 UNIQ_KEY 查询.
+func parseOffsetMsgID(id string) (offsetMsgID, error) {
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return offsetMsgID{}, errors.WithStack(err)
+	}
+
+	var ip net.IP
+	switch len(raw) {
+	case 16:
+		ip = net.IP(raw[:4])
+	case 28:
+		ip = net.IP(raw[:16])
+	default:
+		return offsetMsgID{}, errors.Errorf("invalid offset msgId %s", id)
+	}
+
+	rest := raw[len(ip):]
+	port := binary.BigEndian.Uint32(rest[:4])
+	if port == 0 || port > 65535 {
+		return offsetMsgID{}, errors.Errorf("invalid offset msgId %s", id)
+	}
+
+	return offsetMsgID{
+		addr:   net.JoinHostPort(ip.String(), strconv.Itoa(int(port))),
+		offset: int64(binary.BigEndian.Uint64(rest[4:12])),
+	}, nil
+}
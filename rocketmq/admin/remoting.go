@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 请求码, 与 org.apache.rocketmq.common.protocol.RequestCode 保持一致.
+const (
+	reqPullMessage             = 11
+	reqQueryMessage            = 12
+	reqQueryConsumerOffset     = 14
+	reqUpdateConsumerOffset    = 15
+	reqSearchOffsetByTimestamp = 29
+	reqGetMaxOffset            = 30
+	reqGetMinOffset            = 31
+	reqViewMessageByID         = 33
+	reqGetRouteInfoByTopic     = 105
+)
+
+// 响应码, 与 org.apache.rocketmq.common.protocol.ResponseCode 保持一致.
+const (
+	resSuccess              = 0
+	resTopicNotExist        = 17
+	resPullNotFound         = 19
+	resPullRetryImmediately = 20
+	resPullOffsetMoved      = 21
+	resQueryNotFound        = 22
+)
+
+const (
+	languageGo      = "GO"
+	remotingVersion = 317
+	flagResponse    = 1
+
+	defaultInvokeTimeout = 3 * time.Second
+	// maxFrameSize 单个响应的最大长度, 超过时视为损坏的数据, 避免按错误的长度分配内存.
+	maxFrameSize = 16 << 20
+)
+
+var opaque int32
+
+type command struct {
+	Code      int               `json:"code"`
+	Language  string            `json:"language"`
+	Version   int               `json:"version"`
+	Opaque    int32             `json:"opaque"`
+	Flag      int               `json:"flag"`
+	Remark    string            `json:"remark"`
+	ExtFields map[string]string `json:"extFields"`
+	Body      []byte            `json:"-"`
+}
+
+func newCommand(code int, ext map[string]string) *command {
+	return &command{
+		Code:      code,
+		Language:  languageGo,
+		Version:   remotingVersion,
+		Opaque:    atomic.AddInt32(&opaque, 1),
+		ExtFields: ext,
+	}
+}
+
+func (c *command) encode() ([]byte, error) {
+	header, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, 8+len(header)+len(c.Body)))
+	_ = binary.Write(buf, binary.BigEndian, int32(4+len(header)+len(c.Body)))
+	// 高 8 位为序列化类型, 0 表示 JSON.
+	_ = binary.Write(buf, binary.BigEndian, int32(len(header)))
+	buf.Write(header)
+	buf.Write(c.Body)
+	return buf.Bytes(), nil
+}
+
+func decodeCommand(r io.Reader) (*command, error) {
+	var length int32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if length < 4 || length > maxFrameSize {
+		return nil, errors.Errorf("remoting: malformed frame, length %d", length)
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	headerLength := int(binary.BigEndian.Uint32(frame[:4]) & 0xFFFFFF)
+	if 4+headerLength > len(frame) {
+		return nil, errors.Errorf("remoting: malformed frame, header length %d", headerLength)
+	}
+
+	c := &command{}
+	if err := json.Unmarshal(frame[4:4+headerLength], c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.Body = frame[4+headerLength:]
+	return c, nil
+}
+
+// sign 按 AclClientRPCHook 的规则对请求签名.
+func sign(c *command, credentials primitive.Credentials) {
+	if credentials.AccessKey == "" {
+		return
+	}
+	if c.ExtFields == nil {
+		c.ExtFields = make(map[string]string)
+	}
+
+	c.ExtFields["AccessKey"] = credentials.AccessKey
+	if credentials.SecurityToken != "" {
+		c.ExtFields["SecurityToken"] = credentials.SecurityToken
+	}
+
+	keys := make([]string, 0, len(c.ExtFields))
+	for k := range c.ExtFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	content := bytes.NewBuffer(nil)
+	for _, k := range keys {
+		content.WriteString(c.ExtFields[k])
+	}
+	content.Write(c.Body)
+
+	mac := hmac.New(sha1.New, []byte(credentials.SecretKey))
+	mac.Write(content.Bytes())
+	c.ExtFields["Signature"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// invoke 建立短连接发送一次同步请求. 管理类请求频率很低, 不做连接复用.
+func invoke(ctx context.Context, addr string, c *command, credentials primitive.Credentials) (*command, error) {
+	sign(c, credentials)
+	frame, err := c.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultInvokeTimeout)
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "remoting: dial %s", addr)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(deadline)
+
+	if _, err = conn.Write(frame); err != nil {
+		return nil, errors.Wrapf(err, "remoting: write %s", addr)
+	}
+
+	for {
+		resp, err := decodeCommand(conn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "remoting: read %s", addr)
+		}
+		if resp.Flag&flagResponse == flagResponse && resp.Opaque == c.Opaque {
+			return resp, nil
+		}
+	}
+}
+
+type remotingError struct {
+	Code   int
+	Remark string
+}
+
+func (e *remotingError) Error() string {
+	return "remoting: code " + strconv.Itoa(e.Code) + ", " + e.Remark
+}
+
+func newRemotingError(c *command) error {
+	return errors.WithStack(&remotingError{Code: c.Code, Remark: c.Remark})
+}
+
+// IsNotFound 判断错误是否为 broker 返回的未找到.
+func IsNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*remotingError)
+	if !ok {
+		return false
+	}
+	return e.Code == resQueryNotFound || e.Code == resPullNotFound || e.Code == resTopicNotExist
+}
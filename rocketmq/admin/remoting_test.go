@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func frame(length int32, rest ...byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	_ = binary.Write(buf, binary.BigEndian, length)
+	buf.Write(rest)
+	return buf.Bytes()
+}
+
+func TestDecodeCommand(t *testing.T) {
+	c := newCommand(reqQueryMessage, map[string]string{"topic": "test"})
+	c.Body = []byte("body")
+	b, err := c.encode()
+	if err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	got, err := decodeCommand(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decodeCommand() error = %v", err)
+	}
+	if got.Code != reqQueryMessage || got.ExtFields["topic"] != "test" || string(got.Body) != "body" {
+		t.Errorf("decodeCommand() = %+v", got)
+	}
+}
+
+func TestDecodeCommandMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "empty", in: nil},
+		{name: "short length", in: []byte{0, 0}},
+		{name: "negative length", in: frame(-1)},
+		{name: "length below header", in: frame(2, 0, 0)},
+		{name: "length too large", in: frame(maxFrameSize + 1)},
+		{name: "max int32 length", in: frame(1<<31 - 1)},
+		{name: "truncated frame", in: frame(16, 0, 0, 0, 2)},
+		{name: "header length exceeds frame", in: frame(6, 0, 0, 0, 9, '{', '}')},
+		{name: "invalid header", in: frame(6, 0, 0, 0, 2, '{', '[')},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCommand(bytes.NewReader(tt.in)); err == nil {
+				t.Errorf("decodeCommand() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/linhoi/mq/external/gclient/resolver/consul"
+	"github.com/linhoi/mq/external/gclient/resolver/dns"
+	"github.com/linhoi/mq/external/gclient/resolver/static"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/pkg/errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEjectFailures = 3
+	defaultEjectCooldown = 30 * time.Second
+)
+
+// httpTarget http+dns://, http+consul:// 与 http+static:// 回调解析出的服务发现地址与请求路径.
+type httpTarget struct {
+	scheme    string // http 或 https.
+	discovery string // 服务发现地址, 如 consul://agent/service?tag=..
+	path      string // 请求路径, dns 与 static 的 query 参数也在其中.
+}
+
+func isHTTPDiscovery(url string) bool {
+	return strings.HasPrefix(url, "http+") || strings.HasPrefix(url, "https+")
+}
+
+// parseHTTPTarget 解析 http+dns://[authority]/host:port/path, http+consul://agent/service/path?tag=..
+// 与 http+static:///host1:port1,host2:port2/path, https+ 前缀使用 https. consul 的 query 参数用于服务发现,
+// 未设置 healthy 时只选择健康检查通过的实例.
+func parseHTTPTarget(rawURL string) (httpTarget, error) {
+	i := strings.Index(rawURL, "://")
+	j := strings.Index(rawURL, "+")
+	if i < 0 || j < 0 || j > i {
+		return httpTarget{}, errors.Errorf("callbackURL %q, want http+<dns|consul|static>://...", rawURL)
+	}
+	t := httpTarget{scheme: rawURL[:j]}
+	if t.scheme != "http" && t.scheme != "https" {
+		return httpTarget{}, errors.Errorf("callbackURL %q, want http+ or https+", rawURL)
+	}
+
+	u, err := url.Parse(rawURL[j+1:])
+	if err != nil {
+		return httpTarget{}, errors.Wrapf(err, "callbackURL %q", rawURL)
+	}
+	segments := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	endpoint := segments[0]
+	t.path = "/"
+	if len(segments) == 2 {
+		t.path += segments[1]
+	}
+
+	switch u.Scheme {
+	case dns.Scheme:
+		if err = checkHostPort(endpoint); err != nil {
+			return httpTarget{}, errors.Wrapf(err, "callbackURL %q, want http+dns://[authority]/host:port/path", rawURL)
+		}
+		t.discovery = dns.Scheme + "://" + u.Host + "/" + endpoint
+
+	case "consul":
+		q := u.Query()
+		if _, ok := q["healthy"]; !ok {
+			q.Set("healthy", "true")
+		}
+		authority := u.Host
+		if u.User != nil {
+			authority = u.User.String() + "@" + authority
+		}
+		t.discovery = "consul://" + authority + "/" + endpoint + "?" + q.Encode()
+		if err = consul.Validate(t.discovery); err != nil {
+			return httpTarget{}, errors.Wrapf(err, "callbackURL %q, want http+consul://agent/service/path", rawURL)
+		}
+		u.RawQuery = ""
+
+	case static.Scheme:
+		if u.Host != "" {
+			return httpTarget{}, errors.Errorf("callbackURL %q, want http+static:///host1:port1,host2:port2/path", rawURL)
+		}
+		if _, err = static.Parse(endpoint); err != nil {
+			return httpTarget{}, errors.Wrapf(err, "callbackURL %q", rawURL)
+		}
+		t.discovery = static.Scheme + ":///" + endpoint
+
+	default:
+		return httpTarget{}, errors.Errorf("unsupported callbackURL %q", rawURL)
+	}
+
+	if u.RawQuery != "" {
+		t.path += "?" + u.RawQuery
+	}
+	return t, nil
+}
+
+// endpoint 返回本次回调使用的地址, 服务发现的回调按轮询选择实例. report 记录本次回调实例是否失败.
+func (c *Callback) endpoint(ctx context.Context, rawURL string, conf config.Ejection) (string, func(failed bool), error) {
+	if !isHTTPDiscovery(rawURL) {
+		return rawURL, func(bool) {}, nil
+	}
+	t, err := parseHTTPTarget(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	addrs, err := c.addrs.resolve(ctx, t.discovery)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c.mu.Lock()
+	b, ok := c.balancers[t.discovery]
+	if !ok {
+		b = newBalancer(t.discovery)
+		c.balancers[t.discovery] = b
+	}
+	c.mu.Unlock()
+
+	addr := b.pick(addrs)
+	return t.scheme + "://" + addr + t.path, func(failed bool) { b.report(ctx, addr, failed, conf) }, nil
+}
+
+// balancer 在服务发现的实例间轮询, 连续失败的实例在冷却时间内不再选择.
+type balancer struct {
+	discovery string
+
+	mu       sync.Mutex
+	next     int
+	failures map[string]int
+	ejected  map[string]time.Time
+}
+
+func newBalancer(discovery string) *balancer {
+	return &balancer{discovery: discovery, failures: make(map[string]int), ejected: make(map[string]time.Time)}
+}
+
+// pick 轮询选择未摘除的实例, 全部实例都被摘除时选择最早恢复的实例.
+func (b *balancer) pick(addrs []string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var earliest string
+	for i := range addrs {
+		addr := addrs[(b.next+i)%len(addrs)]
+		until, ok := b.ejected[addr]
+		if ok && now.Before(until) {
+			if earliest == "" || until.Before(b.ejected[earliest]) {
+				earliest = addr
+			}
+			continue
+		}
+		delete(b.ejected, addr)
+		b.next = (b.next + i + 1) % len(addrs)
+		return addr
+	}
+	return earliest
+}
+
+func (b *balancer) report(ctx context.Context, addr string, failed bool, conf config.Ejection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		delete(b.failures, addr)
+		return
+	}
+
+	failures, cooldown := conf.Failures, conf.Cooldown
+	if failures <= 0 {
+		failures = defaultEjectFailures
+	}
+	if cooldown <= 0 {
+		cooldown = defaultEjectCooldown
+	}
+	b.failures[addr]++
+	if b.failures[addr] < failures {
+		return
+	}
+	delete(b.failures, addr)
+	b.ejected[addr] = time.Now().Add(cooldown)
+	log.S(ctx).Warnw("callback instance ejected", "callback", b.discovery, "addr", addr, "cooldown", cooldown)
+}
+
+func validateEjection(conf config.Ejection) error {
+	if conf.Failures < 0 || conf.Cooldown < 0 {
+		return errors.Errorf("ejection failures %d and cooldown %s must not be negative", conf.Failures, conf.Cooldown)
+	}
+	return nil
+}
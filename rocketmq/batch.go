@@ -0,0 +1,162 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchMaxSize = 32
+	defaultBatchLinger  = 100 * time.Millisecond
+
+	deliveredTTL = 3 * time.Hour // 最长重试间隔为 2h, 已投递记录保留到超过该间隔.
+)
+
+// batchFlush 投递一批消息, 返回每条消息的处理结果, 与 msgs 一一对应.
+type batchFlush func(ctx context.Context, msgs []*primitive.MessageExt) []error
+
+// batcher 把多个消费协程拉取到的消息合并, 达到 maxSize 或等待超过 linger 时一次性投递.
+type batcher struct {
+	maxSize int
+	linger  time.Duration
+	flush   batchFlush
+
+	mu      sync.Mutex
+	pending []*pendingMessage
+	timer   *time.Timer
+}
+
+type pendingMessage struct {
+	msg  *primitive.MessageExt
+	done chan error
+}
+
+func newBatcher(maxSize int, linger time.Duration, flush batchFlush) *batcher {
+	if maxSize <= 0 {
+		maxSize = defaultBatchMaxSize
+	}
+	if linger <= 0 {
+		linger = defaultBatchLinger
+	}
+	return &batcher{maxSize: maxSize, linger: linger, flush: flush}
+}
+
+// submit 提交消息并等待所在批次投递完成, 返回每条消息的处理结果.
+// ctx 结束时还未发出的消息从队列中移除并返回 ctx 的错误, 已发出的消息照常等待结果, 避免重试与批次重复投递.
+func (b *batcher) submit(ctx context.Context, msgs []*primitive.MessageExt) []error {
+	items := make([]*pendingMessage, 0, len(msgs))
+
+	b.mu.Lock()
+	for _, msg := range msgs {
+		item := &pendingMessage{msg: msg, done: make(chan error, 1)}
+		items = append(items, item)
+		b.pending = append(b.pending, item)
+		if len(b.pending) >= b.maxSize {
+			b.sendLocked()
+		}
+	}
+	if len(b.pending) > 0 && b.timer == nil {
+		b.timer = time.AfterFunc(b.linger, func() {
+			b.mu.Lock()
+			b.sendLocked()
+			b.mu.Unlock()
+		})
+	}
+	b.mu.Unlock()
+
+	errs := make([]error, len(items))
+	for i, item := range items {
+		select {
+		case errs[i] = <-item.done:
+		case <-ctx.Done():
+			if b.remove(item) {
+				errs[i] = ctx.Err()
+			} else {
+				errs[i] = <-item.done
+			}
+		}
+	}
+	return errs
+}
+
+// remove 从队列中移除还未发出的消息, 已发出时返回 false.
+func (b *batcher) remove(item *pendingMessage) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, pending := range b.pending {
+		if pending == item {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			if len(b.pending) == 0 && b.timer != nil {
+				b.timer.Stop()
+				b.timer = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (b *batcher) sendLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+
+	batch := b.pending
+	b.pending = nil
+	go func() {
+		msgs := make([]*primitive.MessageExt, len(batch))
+		for i, item := range batch {
+			msgs[i] = item.msg
+		}
+
+		errs := b.flush(context.Background(), msgs)
+		for i, item := range batch {
+			item.done <- errs[i]
+		}
+	}()
+}
+
+// deliveredSet 记录批次中已投递成功的消息, 批次部分失败整体重试时跳过这些消息.
+type deliveredSet struct {
+	mu    sync.Mutex
+	items map[string]time.Time
+}
+
+func newDeliveredSet() *deliveredSet {
+	return &deliveredSet{items: make(map[string]time.Time)}
+}
+
+func (s *deliveredSet) add(msgID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, expire := range s.items {
+		if now.After(expire) {
+			delete(s.items, id)
+		}
+	}
+	s.items[msgID] = now.Add(deliveredTTL)
+}
+
+func (s *deliveredSet) contains(msgID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expire, ok := s.items[msgID]
+	return ok && time.Now().Before(expire)
+}
+
+func (s *deliveredSet) remove(msgID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, msgID)
+}
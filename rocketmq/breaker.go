@@ -0,0 +1,245 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerMinRequests = 20
+	defaultBreakerRate        = 0.5
+	defaultBreakerOpen        = 30 * time.Second
+	defaultBreakerProbes      = 3
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+var errBreakerStopped = errors.New("consumer stopped while callback circuit breaker is not closed")
+
+// breaker 回调熔断器. 熔断时回调阻塞等待, 由 onChange 暂停对应的 push consumer,
+// 半开时恢复拉取, 只放行 HalfOpenProbes 个探测回调, 其余回调等待熔断器关闭.
+type breaker struct {
+	callback string // 用于日志与监控, 已去掉用户信息与 query 参数.
+	conf     config.Breaker
+	onChange func()
+
+	mu        sync.Mutex
+	state     breakerState
+	windowEnd time.Time
+	total     int
+	failures  int
+	slow      int
+	probes    int // 半开时已放行的探测数.
+	successes int // 半开时探测成功数.
+	changed   chan struct{}
+	timer     *time.Timer
+}
+
+// newBreaker onChange 在状态变更后调用, 调用时不持有熔断器的锁.
+func newBreaker(callback string, conf config.Breaker, onChange func()) *breaker {
+	if conf.Window <= 0 {
+		conf.Window = defaultBreakerWindow
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultBreakerMinRequests
+	}
+	if conf.ErrorRate <= 0 {
+		conf.ErrorRate = defaultBreakerRate
+	}
+	if conf.SlowRate <= 0 {
+		conf.SlowRate = defaultBreakerRate
+	}
+	if conf.OpenDuration <= 0 {
+		conf.OpenDuration = defaultBreakerOpen
+	}
+	if conf.HalfOpenProbes <= 0 {
+		conf.HalfOpenProbes = defaultBreakerProbes
+	}
+
+	callback = callbackLabel(callback)
+	breakerStateGauge.WithLabelValues(callback).Set(float64(breakerClosed))
+	return &breaker{callback: callback, conf: conf, onChange: onChange, changed: make(chan struct{})}
+}
+
+// allow 等待熔断器放行, probe 表示本次回调是半开状态的探测, 结束后需要调用 done.
+func (b *breaker) allow(ctx context.Context, stop <-chan struct{}) (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+
+	for {
+		b.mu.Lock()
+		if b.state == breakerClosed {
+			b.mu.Unlock()
+			return false, nil
+		}
+		if b.state == breakerHalfOpen && b.probes < b.conf.HalfOpenProbes {
+			b.probes++
+			b.mu.Unlock()
+			return true, nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-stop:
+			return false, errBreakerStopped
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// cancel 放弃放行后未执行的回调.
+func (b *breaker) cancel(probe bool) {
+	if b == nil || !probe {
+		return
+	}
+
+	b.mu.Lock()
+	if b.state == breakerHalfOpen {
+		b.probes--
+		b.wakeLocked()
+	}
+	b.mu.Unlock()
+}
+
+// done 记录回调结果.
+func (b *breaker) done(probe bool, err error, elapsed time.Duration) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	changed := b.recordLocked(probe, err, elapsed)
+	b.mu.Unlock()
+
+	if changed {
+		b.onChange()
+	}
+}
+
+func (b *breaker) recordLocked(probe bool, err error, elapsed time.Duration) bool {
+	if probe {
+		if b.state != breakerHalfOpen {
+			return false
+		}
+		if err != nil {
+			return b.toLocked(breakerOpen, "probe failed")
+		}
+		b.successes++
+		if b.successes >= b.conf.HalfOpenProbes {
+			return b.toLocked(breakerClosed, "probes succeeded")
+		}
+		return false
+	}
+
+	if b.state != breakerClosed {
+		return false
+	}
+
+	now := time.Now()
+	if now.After(b.windowEnd) {
+		b.resetLocked()
+		b.windowEnd = now.Add(b.conf.Window)
+	}
+	b.total++
+	if err != nil {
+		b.failures++
+	}
+	if b.conf.SlowCall > 0 && elapsed >= b.conf.SlowCall {
+		b.slow++
+	}
+
+	if b.total < b.conf.MinRequests {
+		return false
+	}
+	if rate := float64(b.failures) / float64(b.total); rate >= b.conf.ErrorRate {
+		return b.toLocked(breakerOpen, "error rate exceeded")
+	}
+	if rate := float64(b.slow) / float64(b.total); b.conf.SlowCall > 0 && rate >= b.conf.SlowRate {
+		return b.toLocked(breakerOpen, "slow call rate exceeded")
+	}
+	return false
+}
+
+func (b *breaker) toLocked(to breakerState, reason string) bool {
+	from := b.state
+	if from == to {
+		return false
+	}
+
+	log.S(context.Background()).Warnw("callback breaker state changed", "callback", b.callback,
+		"from", from, "to", to, "reason", reason, "total", b.total, "failures", b.failures, "slow", b.slow)
+	breakerStateGauge.WithLabelValues(b.callback).Set(float64(to))
+	breakerTransitions.WithLabelValues(b.callback, from.String(), to.String()).Inc()
+
+	b.state = to
+	b.resetLocked()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if to == breakerOpen {
+		b.timer = time.AfterFunc(b.conf.OpenDuration, b.halfOpen)
+	}
+	b.wakeLocked()
+	return true
+}
+
+func (b *breaker) halfOpen() {
+	b.mu.Lock()
+	changed := b.state == breakerOpen && b.toLocked(breakerHalfOpen, "open duration elapsed")
+	b.mu.Unlock()
+
+	if changed {
+		b.onChange()
+	}
+}
+
+func (b *breaker) resetLocked() {
+	b.total, b.failures, b.slow = 0, 0, 0
+	b.probes, b.successes = 0, 0
+	b.windowEnd = time.Time{}
+}
+
+func (b *breaker) wakeLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// open 熔断器是否处于熔断状态, 此时应暂停拉取.
+func (b *breaker) open() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == breakerOpen
+}
@@ -1,33 +1,56 @@
 package rocketmq
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/external/webhook"
+	"github.com/linhoi/mq/internal/config"
 	"github.com/motemen/go-loghttp"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
 type Callback struct {
-	client *http.Client
+	mu        sync.Mutex
+	clients   map[config.TLS]*http.Client
+	templates map[string]*template.Template
+	tokens    map[string]*oauth2Token
+	addrs     *addrResolver
+	balancers map[string]*balancer
+	rules     map[string]*successRule
 }
 
 const (
 	defaultTimeout = 10 * time.Second // 超时时间.
+	defaultMethod  = http.MethodPut
+
+	// propertyTTL 消息的存活时间, 单位毫秒, 从生产时间开始计算. 超过存活时间的消息不再回调.
+	propertyTTL = "TTL"
+	// oauth2ExpiryDelta 提前刷新 token 的时间.
+	oauth2ExpiryDelta = 30 * time.Second
+	// maxSigningSecrets 轮换期间同时生效的签名 secret 数.
+	maxSigningSecrets = 2
 )
 
 func NewCallback() *Callback {
-	defaultTransport := http.DefaultTransport
-	defaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: false}
-	transport := &loghttp.Transport{
-		Transport: defaultTransport,
-	}
 	return &Callback{
-		client: &http.Client{Timeout: defaultTimeout, Transport: transport},
+		clients:   make(map[config.TLS]*http.Client),
+		templates: make(map[string]*template.Template),
+		tokens:    make(map[string]*oauth2Token),
+		addrs:     newAddrResolver(nil),
+		balancers: make(map[string]*balancer),
+		rules:     make(map[string]*successRule),
 	}
 }
 
@@ -36,30 +59,420 @@ type CallbackResponse struct {
 	Msg     string      `json:"msg"`
 	Data    interface{} `json:"data"`
 	TraceId string      `json:"traceId"`
+	// Failed 批量回调时处理失败需要重试的消息ID.
+	Failed []string `json:"failed"`
+	// Outcome 回调结果 success, retry, discard 或 deadLetter, 为空时 code 非0表示重试.
+	Outcome string `json:"outcome"`
+	// RetryAfter outcome 为 retry 时的重试间隔秒数, 取不小于该值的延迟级别.
+	RetryAfter int `json:"retryAfter"`
+	// DelayLevel outcome 为 retry 时的延迟级别 1-18, 优先于 retryAfter.
+	DelayLevel int `json:"delayLevel"`
+	// Results 批量回调时每条消息的结果, 未列出的消息按 failed 判断.
+	Results []CallbackResult `json:"results"`
+}
+
+type CallbackResult struct {
+	MsgID      string `json:"msgId"`
+	Outcome    string `json:"outcome"`
+	RetryAfter int    `json:"retryAfter"`
+	DelayLevel int    `json:"delayLevel"`
+	Reason     string `json:"reason"`
 }
 
-func (c *Callback) call(ctx context.Context, path string, body interface{}, cookie string) (code int, err error) {
-	resp := &CallbackResponse{}
+// err 返回整个响应的回调结果, 成功时为 nil.
+func (r *CallbackResponse) err() error {
+	if r.Outcome == "" && r.Code != 0 {
+		return errors.Errorf("callback code %d, msg %s", r.Code, r.Msg)
+	}
+	return newOutcome(r.Outcome, time.Duration(r.RetryAfter)*time.Second, r.DelayLevel, r.Msg)
+}
+
+func (r CallbackResult) err() error {
+	return newOutcome(r.Outcome, time.Duration(r.RetryAfter)*time.Second, r.DelayLevel, r.Reason)
+}
+
+// headerData 请求头模板的数据, 批量回调时为第一条消息的值.
+type headerData struct {
+	Group      string
+	Topic      string
+	MsgID      string
+	Tags       string
+	Keys       string
+	Count      int
+	Properties map[string]string
+}
+
+// call 按消费组的 http 配置回调 msgs, body 为单条或批量回调的消息体, t 为 msgs 转换后的请求, 未配置转换时为 nil.
+func (c *Callback) call(ctx context.Context, consumerConf config.Consumer, msgs []*primitive.MessageExt, body interface{}, t *transformed) (*CallbackResponse, error) {
+	conf := consumerConf.HTTP
+	client, err := c.client(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := c.successRule(consumerConf)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := requestContext(ctx, conf.Timeout, msgs)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
 
 	josnBody, err := json.Marshal(body)
 	if err != nil {
-		return http.StatusBadRequest, err
+		return nil, errors.WithStack(err)
+	}
+	if t != nil && len(t.bodies) > 0 {
+		p, ok := body.(*Payload)
+		josnBody = t.httpBody(ok && p.Message == nil)
+	}
+
+	callbackURL, report, err := c.endpoint(ctx, consumerConf.CallbackURL, conf.Ejection)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil && len(t.query) > 0 {
+		u, err := url.Parse(callbackURL)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		q := u.Query()
+		for name, value := range t.query {
+			q.Set(name, value)
+		}
+		u.RawQuery = q.Encode()
+		callbackURL = u.String()
 	}
 
-	httpRequest, err := http.NewRequest(http.MethodPut, path, strings.NewReader(string(josnBody)))
+	method := conf.Method
+	if method == "" {
+		method = defaultMethod
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), callbackURL, bytes.NewReader(josnBody))
 	if err != nil {
-		return http.StatusNotAcceptable, err
+		return nil, errors.WithStack(err)
+	}
+	httpRequest.Header.Set("format", "json")
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if secrets := conf.Signing.Secrets; len(secrets) > 0 {
+		timestamp := time.Now().Unix()
+		httpRequest.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		httpRequest.Header.Set(webhook.HeaderSignature, webhook.SignatureHeader(secrets, timestamp, josnBody))
+	}
+
+	if len(conf.Headers) > 0 && len(msgs) > 0 {
+		data := newHeaderData(consumerConf.GroupID, msgs)
+		for name, value := range conf.Headers {
+			rendered, err := c.render(value, data)
+			if err != nil {
+				return nil, err
+			}
+			httpRequest.Header.Set(name, rendered)
+		}
+	}
+	if t != nil {
+		for name, value := range t.headers {
+			httpRequest.Header.Set(name, value)
+		}
+	}
+	if err = c.authorize(ctx, client, httpRequest, conf.Auth); err != nil {
+		return nil, err
 	}
-	httpRequest.Header.Add("format", "json")
-	httpRequest.Header.Add("Cookie", cookie)
 
-	response, err := c.client.Do(httpRequest)
+	response, err := client.Do(httpRequest)
+	report(err != nil || response.StatusCode >= http.StatusInternalServerError)
 	if err != nil {
-		return http.StatusNotAcceptable, err
+		return nil, errors.WithStack(err)
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode == http.StatusUnauthorized && conf.Auth.Type == config.AuthOAuth2 {
+		c.token(conf.Auth.OAuth2).invalidate()
+	}
+
 	resBody, err := ioutil.ReadAll(response.Body)
-	err = json.Unmarshal(resBody,&resp)
-	return resp.Code, errors.WithStack(err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rule.evaluate(response.StatusCode, response.Header, resBody)
+}
+
+// requestContext 请求的超时取配置的超时与消息剩余存活时间中较小的, 所有消息都已过期时直接丢弃.
+func requestContext(ctx context.Context, timeout time.Duration, msgs []*primitive.MessageExt) (context.Context, context.CancelFunc, error) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	var expire time.Time
+	for _, msg := range msgs {
+		ttl, err := strconv.ParseInt(msg.GetProperty(propertyTTL), 10, 64)
+		if err != nil || ttl <= 0 {
+			expire = time.Time{}
+			break
+		}
+		// 批量回调时只要有消息未过期就继续回调.
+		if t := time.Unix(0, (msg.BornTimestamp+ttl)*int64(time.Millisecond)); t.After(expire) {
+			expire = t
+		}
+	}
+	if !expire.IsZero() {
+		if !expire.After(time.Now()) {
+			return nil, nil, &OutcomeError{Outcome: OutcomeDiscard, Reason: "message ttl expired"}
+		}
+		if expire.Before(deadline) {
+			deadline = expire
+		}
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, cancel, nil
+}
+
+func newHeaderData(group string, msgs []*primitive.MessageExt) headerData {
+	msg := newPayloadMessage(msgs[0])
+	return headerData{
+		Group:      group,
+		Topic:      msg.Topic,
+		MsgID:      msg.MsgID,
+		Tags:       msg.Tags,
+		Keys:       strings.Join(msg.Keys, " "),
+		Count:      len(msgs),
+		Properties: msg.Properties,
+	}
+}
+
+func (c *Callback) render(text string, data interface{}) (string, error) {
+	c.mu.Lock()
+	tmpl, ok := c.templates[text]
+	c.mu.Unlock()
+
+	if !ok {
+		var err error
+		if tmpl, err = parseTemplate(text); err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		c.templates[text] = tmpl
+		c.mu.Unlock()
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", errors.Wrapf(err, "render template %q", text)
+	}
+	return sb.String(), nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("callback").Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	return tmpl, errors.Wrapf(err, "parse template %q", text)
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func (c *Callback) client(conf config.TLS) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[conf]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := newTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	// 超时由每次请求的 context 控制.
+	client := &http.Client{Transport: &loghttp.Transport{Transport: transport}}
+	c.clients[conf] = client
+	return client, nil
+}
+
+func newTLSConfig(conf config.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: conf.ServerName, InsecureSkipVerify: conf.InsecureSkipVerify}
+	if conf.CAFile != "" {
+		ca, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no certificate found in %s", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (c *Callback) authorize(ctx context.Context, client *http.Client, req *http.Request, auth config.Auth) error {
+	switch auth.Type {
+	case "":
+	case config.AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case config.AuthBasic:
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case config.AuthOAuth2:
+		token, err := c.token(auth.OAuth2).get(ctx, client)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return errors.Errorf("unsupported auth type %s", auth.Type)
+	}
+	return nil
+}
+
+func (c *Callback) token(conf config.OAuth2) *oauth2Token {
+	key := strings.Join([]string{conf.TokenURL, conf.ClientID, conf.ClientSecret, strings.Join(conf.Scopes, " ")}, "\n")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.tokens[key]
+	if !ok {
+		t = &oauth2Token{conf: conf}
+		c.tokens[key] = t
+	}
+	return t
+}
+
+// oauth2Token client credentials 模式获取的 token, 过期前复用.
+type oauth2Token struct {
+	conf config.OAuth2
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time // 零值表示服务端未返回有效期, 直到回调返回 401 才刷新.
+}
+
+func (t *oauth2Token) get(ctx context.Context, client *http.Client) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && (t.expiry.IsZero() || time.Now().Before(t.expiry)) {
+		return t.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(t.conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.conf.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(t.conf.ClientID), url.QueryEscape(t.conf.ClientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "fetch oauth2 token")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "fetch oauth2 token")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("fetch oauth2 token, status %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &token); err != nil {
+		return "", errors.Wrap(err, "decode oauth2 token")
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("oauth2 token response without access_token")
+	}
+
+	t.token = token.AccessToken
+	t.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		t.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - oauth2ExpiryDelta)
+	}
+	return t.token, nil
+}
+
+func (t *oauth2Token) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.token = ""
+}
+
+// validateHTTP 启动时校验 http 回调配置, 提前加载证书与解析请求头模板.
+func validateHTTP(conf config.HTTP) error {
+	switch strings.ToUpper(conf.Method) {
+	case "", http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return errors.Errorf("unsupported http method %s, want POST, PUT or PATCH", conf.Method)
+	}
+
+	for name, value := range conf.Headers {
+		if _, err := parseTemplate(value); err != nil {
+			return errors.Wrapf(err, "header %s", name)
+		}
+	}
+
+	if len(conf.Signing.Secrets) > maxSigningSecrets {
+		return errors.Errorf("at most %d signing secrets, got %d", maxSigningSecrets, len(conf.Signing.Secrets))
+	}
+	for _, secret := range conf.Signing.Secrets {
+		if secret == "" {
+			return errors.New("empty signing secret")
+		}
+	}
+	if err := validateEjection(conf.Ejection); err != nil {
+		return err
+	}
+
+	if _, err := newSuccessRule(conf.Success); err != nil {
+		return errors.Wrap(err, "success")
+	}
+
+	if _, err := newTLSConfig(conf.TLS); err != nil {
+		return errors.Wrap(err, "tls")
+	}
+
+	switch conf.Auth.Type {
+	case "":
+	case config.AuthBearer:
+		if conf.Auth.Token == "" {
+			return errors.New("bearer auth requires token")
+		}
+	case config.AuthBasic:
+		if conf.Auth.Username == "" {
+			return errors.New("basic auth requires username")
+		}
+	case config.AuthOAuth2:
+		if conf.Auth.OAuth2.TokenURL == "" || conf.Auth.OAuth2.ClientID == "" {
+			return errors.New("oauth2 auth requires tokenURL and clientID")
+		}
+	default:
+		return errors.Errorf("unsupported auth type %s, want %s, %s or %s", conf.Auth.Type, config.AuthBearer, config.AuthBasic, config.AuthOAuth2)
+	}
+	return nil
 }
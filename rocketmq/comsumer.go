@@ -1,143 +1,925 @@
 package rocketmq
 
 import (
+	"bytes"
 	"context"
 	"github.com/apache/rocketmq-client-go/v2"
 	cm "github.com/apache/rocketmq-client-go/v2/consumer"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/linhoi/mq/external/gclient"
+	"github.com/linhoi/mq/external/log"
 	"github.com/linhoi/mq/internal/config"
 	mq "github.com/linhoi/mq/protobuf"
+	"github.com/linhoi/mq/rocketmq/filter"
+	"github.com/linhoi/mq/rocketmq/idempotent"
 	"github.com/pkg/errors"
+	"io/ioutil"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	drainTimeout  = 30 * time.Second       // 停止消费组时等待处理中消息的最长时间.
+	drainInterval = 100 * time.Millisecond // 检查处理中消息数的间隔.
+
+	// broker 默认的延迟级别 1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h.
+	minDelayLevel = 1
+	maxDelayLevel = 18
+	// 重新消费的延迟级别为负数时 broker 直接把消息投递到死信队列.
+	sendToDeadLetter = -1
 )
 
 type Consumer struct {
 	conf       *config.Config
 	callback   *Callback
+	producer   *Producer
 	downstream sync.Map
+	mu         sync.Mutex
+	groups     map[string]*group
+	instances  map[string]config.Instance
+	applied    []config.Consumer // 最近一次成功应用的消费组配置, 不随热更新前的配置变化.
+	started    bool
+	breakers   map[string]*breaker
+	addrs      *addrResolver
+	stores     map[string]idempotent.Store
 	cleanup    []func()
 }
 
-func NewConsumer(conf *config.Config, callback *Callback) *Consumer {
-	return &Consumer{conf: conf, callback: callback}
+// group 一个配置的消费者对应的 push consumer, 可以单独启停.
+type group struct {
+	conf      config.Consumer
+	consumer  rocketmq.PushConsumer
+	inflight  int64
+	batcher   *batcher
+	delivered *deliveredSet
+	flow      *flowControl
+	router    *router
+	dedup     *idempotentGuard
+	breakers  map[string]*breaker // 回调目标的熔断器, 未开启熔断时为空.
+	stopped   chan struct{}
 }
 
+func NewConsumer(conf *config.Config, callback *Callback, producer *Producer) (*Consumer, func()) {
+	c := &Consumer{
+		conf:     conf,
+		callback: callback,
+		producer: producer,
+		groups:   make(map[string]*group),
+		breakers: make(map[string]*breaker),
+		stores:   make(map[string]idempotent.Store),
+	}
+	// 广播回调解析出的地址下线后关闭对应的连接.
+	c.addrs = newAddrResolver(func(removed []string) {
+		gone := make(map[string]bool, len(removed))
+		for _, addr := range removed {
+			gone["grpc://"+addr] = true
+		}
+		c.closeGRPCClients(func(url string) bool { return gone[url] })
+	})
+	c.setInstances(conf.RocketMQ.Instances)
+	c.setConsumers(conf.RocketMQ.Consumers)
+	return c, c.Shutdown
+}
+
+// Start 启动所有配置的消费组, 任一消费组启动失败时停止已启动的消费组并返回错误.
 func (c *Consumer) Start() error {
-	cc := make(map[string]config.Instance)
-	for _, ins := range c.conf.RocketMQ.Instances {
-		cc[ins.Name] = ins
+	c.mu.Lock()
+	consumers := c.applied
+	c.mu.Unlock()
+
+	if err := validateConsumers(consumers); err != nil {
+		return err
 	}
 
-	for _, consumerConf := range c.conf.RocketMQ.Consumers {
-		consumerConf := consumerConf
-		instance := getInstance(consumerConf.Instance)
+	for _, consumerConf := range consumers {
+		if err := c.StartGroup(consumerConf); err != nil {
+			c.StopAll()
+			return err
+		}
+	}
 
-		ins, ok := cc[instance]
-		if !ok {
-			return errors.Errorf("instance not found %s", instance)
+	c.mu.Lock()
+	c.started = true
+	c.mu.Unlock()
+	return nil
+}
+
+// StartGroup 启动单个消费组.
+func (c *Consumer) StartGroup(consumerConf config.Consumer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := groupKey(consumerConf.Instance, consumerConf.GroupID)
+	if _, ok := c.groups[key]; ok {
+		return errors.Errorf("consumer groupID(%s) already running", consumerConf.GroupID)
+	}
+
+	g, err := c.newGroup(consumerConf)
+	if err != nil {
+		return err
+	}
+
+	if err = g.consumer.Start(); err != nil {
+		_ = g.consumer.Shutdown()
+		return errors.Wrapf(err, "start consumer groupID(%s)", consumerConf.GroupID)
+	}
+	if g.blocked() {
+		g.consumer.Suspend()
+	}
+
+	c.groups[key] = g
+	log.S(context.Background()).Infow("consumer started", "groupID", consumerConf.GroupID)
+	return nil
+}
+
+// StopGroup 停止单个消费组, 等待处理中的消息完成后再关闭.
+func (c *Consumer) StopGroup(instance, groupID string) error {
+	key := groupKey(instance, groupID)
+	c.mu.Lock()
+	g, ok := c.groups[key]
+	delete(c.groups, key)
+	c.mu.Unlock()
+
+	if !ok {
+		return errors.Errorf("consumer groupID(%s) not running", groupID)
+	}
+
+	return g.stop()
+}
+
+// StopAll 停止所有运行中的消费组.
+func (c *Consumer) StopAll() {
+	c.mu.Lock()
+	groups := c.groups
+	c.groups = make(map[string]*group)
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *group) {
+			defer wg.Done()
+			if err := g.stop(); err != nil {
+				log.S(context.Background()).Warnw("consumer shutdown", "groupID", g.conf.GroupID, "err", err)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// Ready 最近一次成功应用的配置中的消费组均已运行.
+func (c *Consumer) Ready() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, consumerConf := range c.applied {
+		if _, ok := c.groups[groupKey(consumerConf.Instance, consumerConf.GroupID)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// running 返回本进程中运行的消费组的配置.
+func (c *Consumer) running(instance, groupID string) (config.Consumer, bool) {
+	if c == nil {
+		return config.Consumer{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.groups[groupKey(instance, groupID)]
+	if !ok {
+		return config.Consumer{}, false
+	}
+	consumerConf := g.conf
+	consumerConf.Flow = g.flow.config()
+	return consumerConf, true
+}
+
+func (c *Consumer) isStarted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.started
+}
+
+// setInstances 更新启动消费组时使用的实例配置, 已运行的消费组不受影响.
+func (c *Consumer) setInstances(instances []config.Instance) {
+	m := make(map[string]config.Instance, len(instances))
+	for _, ins := range instances {
+		m[ins.Name] = ins
+	}
+
+	c.mu.Lock()
+	c.instances = m
+	c.mu.Unlock()
+}
+
+// configured 返回最近一次成功应用的配置中的消费组.
+func (c *Consumer) configured(instance, groupID string) (config.Consumer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := groupKey(instance, groupID)
+	for _, consumerConf := range c.applied {
+		if groupKey(consumerConf.Instance, consumerConf.GroupID) == key {
+			return consumerConf, true
+		}
+	}
+	return config.Consumer{}, false
+}
+
+// instance 返回当前生效的实例配置.
+func (c *Consumer) instance(name string) (config.Instance, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ins, ok := c.instances[name]
+	return ins, ok
+}
+
+// setConsumers 记录成功应用的消费组配置.
+func (c *Consumer) setConsumers(consumers []config.Consumer) {
+	applied := make([]config.Consumer, len(consumers))
+	copy(applied, consumers)
+
+	c.mu.Lock()
+	c.applied = applied
+	c.mu.Unlock()
+}
+
+// updateFlow 更新运行中消费组的流控配置. 消费协程数与拉取数量变更需要重建 push consumer, 此时返回 false.
+func (c *Consumer) updateFlow(consumerConf config.Consumer) bool {
+	c.mu.Lock()
+	g, ok := c.groups[groupKey(consumerConf.Instance, consumerConf.GroupID)]
+	c.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	prev := g.flow.config()
+	if prev.ConsumeGoroutines != consumerConf.Flow.ConsumeGoroutines || prev.PullBatchSize != consumerConf.Flow.PullBatchSize {
+		return false
+	}
+
+	g.flow.update(consumerConf.Flow)
+	log.S(context.Background()).Infow("consumer flow updated", "groupID", consumerConf.GroupID, "flow", consumerConf.Flow)
+	return true
+}
+
+// Shutdown 停止所有消费组并关闭下游连接.
+func (c *Consumer) Shutdown() {
+	c.mu.Lock()
+	c.started = false
+	c.mu.Unlock()
+
+	c.StopAll()
+
+	c.mu.Lock()
+	cleanup := c.cleanup
+	c.cleanup = nil
+	c.mu.Unlock()
+
+	for _, fn := range cleanup {
+		fn()
+	}
+	c.closeGRPCClients(func(string) bool { return true })
+}
+
+func (c *Consumer) newGroup(consumerConf config.Consumer) (*group, error) {
+	instance := getInstance(consumerConf.Instance)
+	ins, ok := c.instances[instance]
+	if !ok {
+		return nil, errors.Errorf("instance not found %s", instance)
+	}
+
+	opts := []cm.Option{
+		cm.WithGroupName(consumerConf.GroupID),
+		cm.WithNameServerDomain(ins.NameServer),
+		cm.WithCredentials(primitive.Credentials{
+			AccessKey:     ins.Credentials.AccessKey,
+			SecretKey:     ins.Credentials.SecretKey,
+			SecurityToken: ""}),
+		cm.WithMaxReconsumeTimes(consumerConf.Retry.MaxTimes()),
+	}
+	if consumerConf.Broadcasting() {
+		// 广播模式的位点保存在本地, 目录由 rocketMQ.offsetStoreDir 配置.
+		opts = append(opts, cm.WithConsumerModel(cm.BroadCasting))
+	}
+
+	if consumerConf.Flow.ConsumeGoroutines > 0 {
+		opts = append(opts, cm.WithConsumeGoroutineNums(consumerConf.Flow.ConsumeGoroutines))
+	}
+	if consumerConf.Flow.PullBatchSize > 0 {
+		opts = append(opts, cm.WithPullBatchSize(consumerConf.Flow.PullBatchSize))
+	}
+
+	router, err := newRouter(consumerConf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "consumer groupID(%s)", consumerConf.GroupID)
+	}
+
+	g := &group{
+		conf:      consumerConf,
+		delivered: newDeliveredSet(),
+		flow:      newFlowControl(consumerConf.Flow),
+		router:    router,
+		stopped:   make(chan struct{}),
+	}
+	if consumerConf.Idempotent.Enable {
+		if g.dedup, err = c.idempotentLocked(consumerConf); err != nil {
+			return nil, errors.Wrapf(err, "consumer groupID(%s)", consumerConf.GroupID)
+		}
+	}
+	for _, dest := range router.endpoints() {
+		if !isHTTP(dest.CallbackURL) {
+			continue
+		}
+		if err = c.callback.prepare(destinationConf(consumerConf, dest)); err != nil {
+			return nil, errors.Wrapf(err, "consumer groupID(%s) destination %s", consumerConf.GroupID, dest.Name)
+		}
+	}
+	if consumerConf.Breaker.Enable {
+		g.breakers = make(map[string]*breaker)
+		for _, dest := range router.endpoints() {
+			g.breakers[dest.Name] = c.breakerLocked(dest.CallbackURL, consumerConf.Breaker)
+		}
+	}
+	if consumerConf.Batch.Enable {
+		g.batcher = newBatcher(consumerConf.Batch.MaxSize, consumerConf.Batch.Linger,
+			func(ctx context.Context, msgs []*primitive.MessageExt) []error {
+				return c.fanout(ctx, g, msgs, c.deliverBatch)
+			})
+		opts = append(opts, cm.WithConsumeMessageBatchMaxSize(g.batcher.maxSize))
+	}
+
+	consumer, err := rocketmq.NewPushConsumer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	g.consumer = consumer
+
+	for _, target := range consumerConf.Targets {
+		err = consumer.Subscribe(target.Topic, selector(target),
+			func(ctx context.Context, msg ...*primitive.MessageExt) (cm.ConsumeResult, error) {
+				atomic.AddInt64(&g.inflight, 1)
+				defer atomic.AddInt64(&g.inflight, -1)
+
+				return c.handle(ctx, g, msg...)
+			})
+		if err != nil {
+			return nil, errors.Wrapf(err, "consume failed groupID(%s)", consumerConf.GroupID)
+		}
+	}
+
+	return g, nil
+}
+
+// stop 先暂停拉取, 等待处理中的消息完成后关闭, 关闭时会持久化消费位点.
+func (g *group) stop() error {
+	g.consumer.Suspend()
+	close(g.stopped)
+
+	deadline := time.Now().Add(drainTimeout)
+	for atomic.LoadInt64(&g.inflight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainInterval)
+	}
+	if n := atomic.LoadInt64(&g.inflight); n > 0 {
+		log.S(context.Background()).Warnw("consumer drain timeout", "groupID", g.conf.GroupID, "inflight", n)
+	}
+
+	err := g.consumer.Shutdown()
+	log.S(context.Background()).Infow("consumer stopped", "groupID", g.conf.GroupID)
+	return err
+}
+
+// handle 逐条处理一批消息. 任一消息失败时整批重试, 已成功的消息在重试时跳过.
+// 配置了死信 topic 时, 达到最大重试次数的消息转发到死信 topic 后视为成功.
+// 回调可以通过 outcome 指定重试延迟, 丢弃消息或直接进入死信.
+func (c *Consumer) handle(ctx context.Context, g *group, msgs ...*primitive.MessageExt) (cm.ConsumeResult, error) {
+	pending := make([]*primitive.MessageExt, 0, len(msgs))
+	for _, msg := range msgs {
+		if !g.delivered.contains(msg.MsgId) {
+			pending = append(pending, msg)
+		}
+	}
+
+	// 开启幂等时只回调获取到处理权的消息.
+	errs := make([]error, len(pending))
+	todo, index := pending, []int(nil)
+	var owners map[string]string
+	if g.dedup != nil {
+		todo, index, owners = g.dedup.acquire(ctx, pending, errs)
+	}
+
+	var results []error
+	if g.batcher != nil {
+		results = g.batcher.submit(ctx, todo)
+	} else {
+		results = make([]error, len(todo))
+		for i, msg := range todo {
+			results[i] = c.dispatch(ctx, g, msg)
+		}
+	}
+	for k, err := range results {
+		if index != nil {
+			errs[index[k]] = err
+		} else {
+			errs[k] = err
+		}
+	}
+
+	result := cm.ConsumeSuccess
+	var level int
+	for i, err := range errs {
+		msg := pending[i]
+		outcome := outcomeOf(err)
+		if g.dedup != nil {
+			g.dedup.finish(ctx, msg, owners, err == nil || (outcome != nil && outcome.Outcome == OutcomeDiscard))
+		}
+		switch {
+		case outcome != nil && outcome.Outcome == OutcomeDiscard:
+			log.S(ctx).Infow("message discarded by callback", "groupID", g.conf.GroupID, "msgId", msg.MsgId, "reason", outcome.Reason)
+			err = nil
+		case outcome != nil && outcome.Outcome == OutcomeDeadLetter:
+			if g.conf.Retry.DeadLetter == "" && len(msgs) == 1 {
+				// 由 broker 直接投递到消费组的死信队列.
+				log.S(ctx).Warnw("message sent to dead letter by callback", "groupID", g.conf.GroupID, "msgId", msg.MsgId, "reason", outcome.Reason)
+				result, level = cm.ConsumeRetryLater, sendToDeadLetter
+				continue
+			}
+			err = c.sendDeadLetter(ctx, g.conf, msg, err)
+		case err != nil && g.conf.Retry.DeadLetter != "" && msg.ReconsumeTimes >= g.conf.Retry.MaxTimes():
+			err = c.sendDeadLetter(ctx, g.conf, msg, err)
+		}
+		if err != nil {
+			log.S(ctx).Warnw("deliver message failed", "groupID", g.conf.GroupID, "msgId", msg.MsgId,
+				"reconsumeTimes", msg.ReconsumeTimes, "err", err)
+			result = cm.ConsumeRetryLater
+			next := g.conf.Retry.DelayLevel(msg.ReconsumeTimes)
+			if outcome != nil && outcome.DelayLevel > 0 {
+				next = outcome.DelayLevel
+			}
+			if next > level {
+				level = next
+			}
+			continue
+		}
+		g.delivered.add(msg.MsgId)
+	}
+
+	if result == cm.ConsumeRetryLater {
+		if concurrentCtx, ok := primitive.GetConcurrentlyCtx(ctx); ok {
+			concurrentCtx.DelayLevelWhenNextConsume = level
+		}
+	}
+
+	if result == cm.ConsumeSuccess {
+		for _, msg := range msgs {
+			g.delivered.remove(msg.MsgId)
+		}
+	}
+	return result, nil
+}
+
+// sendDeadLetter 把重试耗尽的消息转发到死信 topic, 转发失败时返回原始错误与转发错误.
+func (c *Consumer) sendDeadLetter(ctx context.Context, consumerConf config.Consumer, msg *primitive.MessageExt, cause error) error {
+	topic := deadLetterTopic(consumerConf)
+	_, err := c.producer.Send(ctx, consumerConf.Instance, deadLetterMessage(topic, msg))
+	if err != nil {
+		return errors.Wrapf(err, "send to dead letter %s after %v", topic, cause)
+	}
+
+	log.S(ctx).Warnw("message sent to dead letter", "groupID", consumerConf.GroupID, "msgId", msg.MsgId,
+		"deadLetter", topic, "err", cause)
+	return nil
+}
+
+// dispatch 在熔断器与流控允许时把单条消息回调到每个目标.
+func (c *Consumer) dispatch(ctx context.Context, g *group, msg *primitive.MessageExt) error {
+	msgs := []*primitive.MessageExt{msg}
+	return c.fanout(ctx, g, msgs, func(ctx context.Context, consumerConf config.Consumer, msgs []*primitive.MessageExt) []error {
+		return []error{c.deliver(ctx, consumerConf, msgs[0])}
+	})[0]
+}
+
+// guard 等待熔断器放行与流控配额后执行回调, 并向熔断器报告结果.
+func (g *group) guard(ctx context.Context, b *breaker, call func() error) error {
+	probe, err := b.allow(ctx, g.stopped)
+	if err != nil {
+		return err
+	}
+	if err = g.flow.acquire(ctx); err != nil {
+		b.cancel(probe)
+		return err
+	}
+	defer g.flow.release()
+
+	start := time.Now()
+	err = call()
+	b.done(probe, callbackFailed(err), time.Since(start))
+	return err
+}
+
+// breakerLocked 返回 callbackURL 的熔断器, 不存在时按消费组的配置创建.
+func (c *Consumer) breakerLocked(url string, conf config.Breaker) *breaker {
+	if b, ok := c.breakers[url]; ok {
+		return b
+	}
+
+	var b *breaker
+	b = newBreaker(url, conf, func() {
+		c.applyBreaker(b)
+	})
+	c.breakers[url] = b
+	return b
+}
+
+// applyBreaker 熔断时暂停使用该 callbackURL 的消费组, 半开或关闭时恢复拉取.
+// 有多个回调目标时按 blocked 判断是否暂停.
+func (c *Consumer) applyBreaker(b *breaker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, g := range c.groups {
+		if !g.uses(b) {
+			continue
+		}
+		open := g.blocked()
+		if open {
+			g.consumer.Suspend()
+		} else {
+			g.consumer.Resume()
 		}
+		log.S(context.Background()).Infow("consumer breaker applied", "groupID", g.conf.GroupID, "callback", b.callback, "suspended", open)
+	}
+}
 
-		consumer, err := rocketmq.NewPushConsumer(
-			cm.WithGroupName(ins.GroupID),
-			cm.WithNameServerDomain(ins.NameServer),
-			cm.WithCredentials(primitive.Credentials{
-				AccessKey:     ins.Credentials.AccessKey,
-				SecretKey:     ins.Credentials.SecretKey,
-				SecurityToken: ""}))
+func (c *Consumer) deliver(ctx context.Context, consumerConf config.Consumer, msg *primitive.MessageExt) error {
+	t, errs := c.callback.transform(consumerConf, []*primitive.MessageExt{msg})
+	if errs != nil {
+		return errs[0]
+	}
 
+	switch {
+	case isHTTP(consumerConf.CallbackURL):
+		resp, err := c.callback.call(ctx, consumerConf, []*primitive.MessageExt{msg}, newPayload(msg), t)
 		if err != nil {
 			return err
 		}
+		return resp.err()
 
-		for _, target := range consumerConf.Targets {
-			target := target
-			err = consumer.Subscribe(target.Topic, cm.MessageSelector{Type: "", Expression: target.Expression()},
-				func(ctx context.Context, msg ...*primitive.MessageExt) (cm.ConsumeResult, error) {
-					for i := range msg {
-						if strings.HasPrefix(consumerConf.CallbackURL, "http://") || strings.HasPrefix(consumerConf.CallbackURL, "https://") {
-							code, err := c.callback.call(ctx, consumerConf.CallbackURL, map[string]interface{}{
-								"topic":         msg[i].Topic,
-								"transactionId": msg[i].TransactionId,
-								"body":          msg[i].Body,
-							}, "")
-							if err != nil || code != 0 {
-								return cm.ConsumeRetryLater, nil
-							}
-							return cm.ConsumeSuccess, nil
-						}
-
-						if strings.HasPrefix(consumerConf.CallbackURL, "grpc://") || strings.HasPrefix(consumerConf.CallbackURL, "dns://") {
-							grpcClient, err := c.getGRPCClient(consumerConf.CallbackURL)
-							if err != nil {
-								return cm.ConsumeRetryLater, nil
-							}
-
-							_, err = grpcClient.RecvMessage(ctx, &mq.RecvMessageRequest{
-								Message: &mq.Message{
-									Topic:       msg[i].Topic,
-									Body:        string(msg[i].Body),
-									MsgId:       msg[i].TransactionId,
-								},
-							})
-							if err != nil {
-								return cm.ConsumeRetryLater, nil
-							}
-
-							return cm.ConsumeSuccess, nil
-						}
-					}
-					return cm.ConsumeSuccess, nil
-				})
+	case isGRPC(consumerConf.CallbackURL):
+		req := &mq.RecvMessageRequest{Message: grpcMessage(msg), Version: PayloadVersion}
+		ctx = t.grpc(ctx, []*mq.Message{req.Message})
+		return c.eachGRPC(ctx, consumerConf, func(grpcClient mq.ConsumerAPIClient) error {
+			resp, err := grpcClient.RecvMessage(ctx, req)
+			if err != nil {
+				return err
+			}
+			return grpcOutcome(resp.Outcome, resp.RetryAfterSeconds, resp.DelayLevel, resp.Reason)
+		})
+	}
+
+	return errors.Errorf("unsupported callbackURL %s", consumerConf.CallbackURL)
+}
 
+// deliverBatch 批量回调, 返回每条消息的处理结果. 转换失败的消息直接进入死信, 其余消息照常回调.
+func (c *Consumer) deliverBatch(ctx context.Context, consumerConf config.Consumer, msgs []*primitive.MessageExt) []error {
+	t, errs := c.callback.transform(consumerConf, msgs)
+	if errs == nil {
+		return c.callBatch(ctx, consumerConf, msgs, t)
+	}
+
+	todo, index := t.pending(msgs, errs)
+	if len(todo) > 0 {
+		for k, err := range c.callBatch(ctx, consumerConf, todo, t) {
+			errs[index[k]] = err
+		}
+	}
+	return errs
+}
+
+// callBatch 批量回调转换后的消息.
+func (c *Consumer) callBatch(ctx context.Context, consumerConf config.Consumer, msgs []*primitive.MessageExt, t *transformed) []error {
+	var (
+		failed   []string
+		outcomes = make(map[string]error)
+		err      error
+	)
+
+	switch {
+	case isHTTP(consumerConf.CallbackURL):
+		var resp *CallbackResponse
+		resp, err = c.callback.call(ctx, consumerConf, msgs, newBatchPayload(msgs), t)
+		if err == nil {
+			err = resp.err()
+		}
+		if err == nil {
+			failed = resp.Failed
+			for _, r := range resp.Results {
+				outcomes[r.MsgID] = r.err()
+			}
+		}
+
+	case isGRPC(consumerConf.CallbackURL):
+		req := &mq.RecvMessagesRequest{Version: PayloadVersion}
+		for _, msg := range msgs {
+			req.Messages = append(req.Messages, grpcMessage(msg))
+		}
+
+		ctx, cancel := context.WithTimeout(t.grpc(ctx, req.Messages), defaultTimeout)
+		defer cancel()
+
+		var mu sync.Mutex
+		err = c.eachGRPC(ctx, consumerConf, func(grpcClient mq.ConsumerAPIClient) error {
+			resp, err := grpcClient.RecvMessages(ctx, req)
 			if err != nil {
-				return errors.Wrapf(err, "consume failed groupID(%s)", consumerConf.GroupID)
+				return err
+			}
+			mu.Lock()
+			failed = append(failed, resp.FailedMsgIds...)
+			for _, o := range resp.Outcomes {
+				// 广播时多个地址返回不同结果, 重试优先.
+				if outcome := outcomeOf(outcomes[o.MsgId]); outcome == nil || outcome.Outcome != OutcomeRetry {
+					outcomes[o.MsgId] = grpcOutcome(o.Outcome, o.RetryAfterSeconds, o.DelayLevel, o.Reason)
+				}
 			}
+			mu.Unlock()
+			return nil
+		})
+
+	default:
+		err = errors.Errorf("unsupported callbackURL %s", consumerConf.CallbackURL)
+	}
+
+	errs := make([]error, len(msgs))
+	failedSet := make(map[string]bool, len(failed))
+	for _, id := range failed {
+		failedSet[id] = true
+	}
+	for i, msg := range msgs {
+		outcome, ok := outcomes[msg.MsgId]
+		switch {
+		case err != nil:
+			errs[i] = err
+		case ok:
+			errs[i] = outcome
+		case failedSet[msg.MsgId]:
+			errs[i] = errors.Errorf("message %s failed in batch callback", msg.MsgId)
+		}
+	}
+	return errs
+}
+
+// eachGRPC 调用 gRPC 回调. 广播模式下 dns://, consul:// 与 static:// 目标解析出的每个地址都会被调用,
+// 任一地址失败时整体失败, 重试时所有地址都会再次收到消息.
+func (c *Consumer) eachGRPC(ctx context.Context, consumerConf config.Consumer, call func(mq.ConsumerAPIClient) error) error {
+	url := consumerConf.CallbackURL
+	if !consumerConf.Broadcasting() || !isDiscovery(url) {
+		grpcClient, err := c.getGRPCClient(url, consumerConf.GRPC)
+		if err != nil {
+			return err
 		}
+		return call(grpcClient)
+	}
+
+	addrs, err := c.addrs.resolve(ctx, url)
+	if err != nil {
+		return err
+	}
 
-		return consumer.Start()
+	errs := make([]error, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			grpcClient, err := c.getGRPCClient("grpc://"+addr, consumerConf.GRPC)
+			if err == nil {
+				err = call(grpcClient)
+			}
+			if err != nil {
+				errs[i] = errors.Wrapf(err, "callback %s", addr)
+			}
+		}(i, addr)
 	}
+	wg.Wait()
 
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("broadcast to %d of %d addresses failed: %s", len(failed), len(addrs), strings.Join(failed, "; "))
+	}
 	return nil
 }
 
-func (c *Consumer) getGRPCClient(url string) (client mq.ConsumerAPIClient, err error) {
-	val, ok := c.downstream.Load(url)
+func isHTTP(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || isHTTPDiscovery(url)
+}
+
+func isGRPC(url string) bool {
+	return strings.HasPrefix(url, "grpc://") || isDiscovery(url)
+}
+
+// grpcClientKey 回调地址相同但连接配置不同的目标使用不同的连接.
+type grpcClientKey struct {
+	url  string
+	conf config.GRPC
+}
+
+// grpcClient 缓存的回调连接.
+type grpcClient struct {
+	mq.ConsumerAPIClient
+	close func()
+}
+
+func (c *Consumer) getGRPCClient(url string, conf config.GRPC) (client mq.ConsumerAPIClient, err error) {
+	key := grpcClientKey{url: url, conf: conf}
+	val, ok := c.downstream.Load(key)
 	if ok {
-		client = val.(mq.ConsumerAPIClient)
+		client = val.(*grpcClient)
 	} else {
-		addr, err := getAddr(url)
-		clientConn, cancel, err := gclient.New(gclient.WithTarget(addr))
+		target, err := parseGRPCTarget(url)
+		if err != nil {
+			return nil, err
+		}
+		opts := append([]gclient.Option{
+			gclient.WithScheme(target.scheme),
+			gclient.WithAuthority(target.authority),
+			gclient.WithEndpoint(target.endpoint),
+		}, grpcOptions(conf)...)
+		clientConn, cancel, err := gclient.New(opts...)
 		if err != nil {
 			return nil, err
 		}
 
-		c.cleanup = append(c.cleanup, func() {
-			cancel()
-			if clientConn != nil {
-				_ = clientConn.Close()
+		created := &grpcClient{
+			ConsumerAPIClient: mq.NewConsumerAPIClient(clientConn),
+			close: func() {
+				cancel()
+				if clientConn != nil {
+					_ = clientConn.Close()
+				}
+			},
+		}
+		// 并发创建同一地址的连接时只保留一个.
+		if val, loaded := c.downstream.LoadOrStore(key, created); loaded {
+			created.close()
+			return val.(*grpcClient), nil
+		}
+		client = created
+	}
+
+	return client, nil
+}
+
+// closeGRPCClients 关闭并移除地址满足 match 的回调连接, 下次回调时重新连接.
+func (c *Consumer) closeGRPCClients(match func(url string) bool) {
+	c.downstream.Range(func(key, val interface{}) bool {
+		if match(key.(grpcClientKey).url) {
+			c.downstream.Delete(key)
+			val.(*grpcClient).close()
+		}
+		return true
+	})
+}
+
+// grpcOptions gRPC 回调的 TLS 与 token 配置.
+func grpcOptions(conf config.GRPC) []gclient.Option {
+	var opts []gclient.Option
+	if conf.Secure {
+		opts = append(opts, gclient.WithTLS())
+	}
+	if conf.TLS.CAFile != "" {
+		opts = append(opts, gclient.WithCAFile(conf.TLS.CAFile))
+	}
+	if conf.TLS.CertFile != "" || conf.TLS.KeyFile != "" {
+		opts = append(opts, gclient.WithClientCert(conf.TLS.CertFile, conf.TLS.KeyFile))
+	}
+	if conf.TLS.ServerName != "" {
+		opts = append(opts, gclient.WithServerName(conf.TLS.ServerName))
+	}
+	if conf.TLS.InsecureSkipVerify {
+		opts = append(opts, gclient.WithInsecureSkipVerify())
+	}
+	if conf.TokenFile != "" {
+		opts = append(opts, gclient.WithTokenFile(conf.TokenFile))
+	}
+	return opts
+}
+
+func validateGRPC(conf config.GRPC) error {
+	secure := conf.Secure || conf.TLS != config.TLS{}
+	if conf.TokenFile != "" {
+		if !secure {
+			return errors.New("tokenFile requires tls")
+		}
+		token, err := ioutil.ReadFile(conf.TokenFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(bytes.TrimSpace(token)) == 0 {
+			return errors.Errorf("tokenFile %s is empty", conf.TokenFile)
+		}
+	}
+	if (conf.TLS.CertFile == "") != (conf.TLS.KeyFile == "") {
+		return errors.New("tls certFile and keyFile must be set together")
+	}
+	_, err := newTLSConfig(conf.TLS)
+	return err
+}
+
+// validateConsumers 同一实例上的消费组只能声明一次, 同组不同订阅会导致 broker 上的订阅关系互相覆盖.
+func validateConsumers(consumers []config.Consumer) error {
+	declared := make(map[string]config.Consumer)
+	for _, consumerConf := range consumers {
+		if consumerConf.GroupID == "" {
+			return errors.Errorf("consumer groupID is required, callbackURL(%s)", consumerConf.CallbackURL)
+		}
+
+		if consumerConf.Model != "" && consumerConf.Model != config.ModelClustering && consumerConf.Model != config.ModelBroadcasting {
+			return errors.Errorf("consumer groupID(%s) model %q, want %s or %s",
+				consumerConf.GroupID, consumerConf.Model, config.ModelClustering, config.ModelBroadcasting)
+		}
+
+		for _, level := range consumerConf.Retry.DelayLevels {
+			if level < minDelayLevel || level > maxDelayLevel {
+				return errors.Errorf("consumer groupID(%s) delay level %d out of range [%d, %d]",
+					consumerConf.GroupID, level, minDelayLevel, maxDelayLevel)
 			}
-		})
+		}
+
+		for _, target := range consumerConf.Targets {
+			if err := validateTarget(target); err != nil {
+				return errors.Wrapf(err, "consumer groupID(%s) topic %s", consumerConf.GroupID, target.Topic)
+			}
+		}
 
-		client = mq.NewConsumerAPIClient(clientConn)
-		c.downstream.Store(url, client)
+		if err := validateDestinations(consumerConf); err != nil {
+			return errors.Wrapf(err, "consumer groupID(%s)", consumerConf.GroupID)
+		}
+		if err := validateIdempotent(consumerConf.Idempotent); err != nil {
+			return errors.Wrapf(err, "consumer groupID(%s) idempotent", consumerConf.GroupID)
+		}
+
+		key := groupKey(consumerConf.Instance, consumerConf.GroupID)
+		prev, ok := declared[key]
+		if !ok {
+			declared[key] = consumerConf
+			continue
+		}
+
+		if !reflect.DeepEqual(subscriptions(prev), subscriptions(consumerConf)) {
+			return errors.Errorf("consumer groupID(%s) declared with different subscriptions %v and %v",
+				consumerConf.GroupID, subscriptions(prev), subscriptions(consumerConf))
+		}
+		return errors.Errorf("consumer groupID(%s) declared more than once on instance %s",
+			consumerConf.GroupID, getInstance(consumerConf.Instance))
 	}
 
-	return client, nil
+	return nil
 }
 
-func getAddr(url string) (string, error) {
-	addr := ""
-	if strings.HasPrefix(url, "dns://") {
-		return addr, nil
+func validateTarget(target config.Target) error {
+	if target.SQL == "" {
+		return nil
+	}
+	if len(target.Tags) > 0 {
+		return errors.New("tags and sql can not be used together")
 	}
+	if _, err := filter.Parse(target.SQL); err != nil {
+		return errors.Wrapf(err, "invalid sql %q", target.SQL)
+	}
+	return nil
+}
 
-	substr := strings.SplitN(url, "://", 2)
-	if len(substr) < 2 {
-		return "", errors.Errorf("address must be http://address or grpc://ip:port, %s", url)
+// selector 返回 target 的订阅方式, 配置了 SQL 时按消息属性过滤.
+func selector(target config.Target) cm.MessageSelector {
+	if target.SQL != "" {
+		return cm.MessageSelector{Type: cm.SQL92, Expression: target.SQL}
 	}
+	return cm.MessageSelector{Type: cm.TAG, Expression: target.Expression()}
+}
 
-	return substr[1], nil
+// subscriptions 返回 topic 到订阅表达式的映射.
+func subscriptions(consumerConf config.Consumer) map[string]string {
+	subs := make(map[string]string)
+	for _, target := range consumerConf.Targets {
+		subs[target.Topic] = target.Expression()
+	}
+	return subs
+}
 
+func groupKey(instance, groupID string) string {
+	return getInstance(instance) + "/" + groupID
 }
@@ -0,0 +1,315 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq/admin"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	deadLetterPrefix = "%DLQ%"
+
+	propertyRetryTopic      = "RETRY_TOPIC"
+	propertyOriginMessageID = "ORIGIN_MESSAGE_ID"
+
+	deadLetterPageSize = 32
+)
+
+// DeadLetterFilter 死信查询条件, 零值字段不参与过滤.
+type DeadLetterFilter struct {
+	Begin time.Time
+	End   time.Time
+	Tag   string
+	Key   string
+	Max   int
+}
+
+func (f DeadLetterFilter) match(msg *primitive.MessageExt) bool {
+	stored := time.Unix(0, msg.StoreTimestamp*int64(time.Millisecond))
+	if !f.Begin.IsZero() && stored.Before(f.Begin) {
+		return false
+	}
+	if !f.End.IsZero() && stored.After(f.End) {
+		return false
+	}
+	if f.Tag != "" && msg.GetProperty(propertyTags) != f.Tag {
+		return false
+	}
+	if f.Key != "" {
+		for _, k := range strings.Fields(msg.GetProperty(propertyKeys)) {
+			if k == f.Key {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// DeadLetter 按消费组查看, 重投与清理死信消息.
+// 死信 topic 没有消费者, 清理通过推进消费组在死信 topic 上的位点实现, 位点之前的消息不再列出.
+type DeadLetter struct {
+	conf     *config.Config
+	admin    *Admin
+	producer *Producer
+	consumer *Consumer
+}
+
+// NewDeadLetter producer 用于重投到原始 topic, consumer 用于直接回调, 只查看时可以为 nil.
+func NewDeadLetter(conf *config.Config, admin *Admin, producer *Producer, consumer *Consumer) *DeadLetter {
+	return &DeadLetter{conf: conf, admin: admin, producer: producer, consumer: consumer}
+}
+
+// Topic 返回消费组的死信 topic, 未配置时为 broker 默认的 %DLQ%groupID.
+func (d *DeadLetter) Topic(instance, group string) string {
+	for _, c := range d.conf.RocketMQ.Consumers {
+		if c.GroupID == group && getInstance(c.Instance) == getInstance(instance) {
+			return deadLetterTopic(c)
+		}
+	}
+	return deadLetterPrefix + group
+}
+
+func deadLetterTopic(consumerConf config.Consumer) string {
+	if consumerConf.Retry.DeadLetter != "" {
+		return consumerConf.Retry.DeadLetter
+	}
+	return deadLetterPrefix + consumerConf.GroupID
+}
+
+// List 列出消费组未清理的死信消息.
+func (d *DeadLetter) List(ctx context.Context, instance, group string, filter DeadLetterFilter) ([]*MessageView, error) {
+	cli, err := d.admin.client(instance)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Max <= 0 {
+		filter.Max = defaultQueryMax
+	}
+
+	topic := d.Topic(instance, group)
+	mqs, err := cli.Queues(ctx, topic)
+	if admin.IsNotFound(err) {
+		// 死信 topic 在第一条死信产生时才创建.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*primitive.MessageExt
+	for _, mq := range mqs {
+		begin, err := d.purged(ctx, cli, group, mq)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.Begin.IsZero() {
+			offset, err := cli.SearchOffset(ctx, mq, filter.Begin)
+			if err != nil {
+				return nil, err
+			}
+			if offset > begin {
+				begin = offset
+			}
+		}
+		end, err := cli.MaxOffset(ctx, mq)
+		if err != nil {
+			return nil, err
+		}
+
+		for begin < end && len(msgs) < filter.Max {
+			next := begin + deadLetterPageSize
+			if next > end {
+				next = end
+			}
+
+			page, err := cli.PullMessages(ctx, mq, begin, next)
+			if err != nil {
+				return nil, err
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, msg := range page {
+				if filter.match(msg) && len(msgs) < filter.Max {
+					msgs = append(msgs, msg)
+				}
+			}
+			begin = page[len(page)-1].QueueOffset + 1
+		}
+	}
+
+	return d.admin.views(ctx, instance, cli, msgs, nil), nil
+}
+
+// Show 按 msgId 查看消费组的一条死信消息.
+func (d *DeadLetter) Show(ctx context.Context, instance, group, msgID string) (*MessageView, error) {
+	views, err := d.admin.QueryByID(ctx, instance, d.Topic(instance, group), msgID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return views[0], nil
+}
+
+// Redrive 把死信消息重新发送到原始 topic, 原始 topic 上的所有消费组都会再次收到该消息.
+func (d *DeadLetter) Redrive(ctx context.Context, instance string, view *MessageView) (*primitive.SendResult, error) {
+	if d.producer == nil {
+		return nil, errors.New("producer is required to redrive dead letters")
+	}
+
+	topic := view.Properties[propertyRetryTopic]
+	if topic == "" {
+		return nil, errors.Errorf("message %s has no original topic", view.MsgID)
+	}
+
+	msg := primitive.NewMessage(topic, []byte(view.Body))
+	for k, v := range view.Properties {
+		if !systemProperties[k] {
+			msg.WithProperty(k, v)
+		}
+	}
+	if view.Tags != "" {
+		msg.WithTag(view.Tags)
+	}
+	if len(view.Keys) > 0 {
+		msg.WithKeys(view.Keys)
+	}
+	if key := view.Properties[propertyShardingKey]; key != "" {
+		msg.WithShardingKey(key)
+	}
+
+	return d.producer.Send(ctx, instance, msg)
+}
+
+// Deliver 把死信消息直接回调到消费组配置的每个回调目标, 其他消费组不受影响.
+func (d *DeadLetter) Deliver(ctx context.Context, instance, group string, view *MessageView) error {
+	if d.consumer == nil {
+		return errors.New("consumer is required to deliver dead letters")
+	}
+
+	for _, c := range d.conf.RocketMQ.Consumers {
+		if c.GroupID == group && getInstance(c.Instance) == getInstance(instance) {
+			return d.consumer.deliverEndpoints(ctx, c, view.message())
+		}
+	}
+	return errors.Errorf("consumer groupID(%s) not configured on instance %s", group, getInstance(instance))
+}
+
+// Purge 清理消费组在 before 之前进入死信的消息, before 为零值时清理全部, 返回清理的消息数.
+// dryRun 时只统计不清理.
+func (d *DeadLetter) Purge(ctx context.Context, instance, group string, before time.Time, dryRun bool) (int64, error) {
+	cli, err := d.admin.client(instance)
+	if err != nil {
+		return 0, err
+	}
+
+	mqs, err := cli.Queues(ctx, d.Topic(instance, group))
+	if admin.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, mq := range mqs {
+		begin, err := d.purged(ctx, cli, group, mq)
+		if err != nil {
+			return purged, err
+		}
+
+		var end int64
+		if before.IsZero() {
+			end, err = cli.MaxOffset(ctx, mq)
+		} else {
+			end, err = cli.SearchOffset(ctx, mq, before)
+		}
+		if err != nil {
+			return purged, err
+		}
+		if end <= begin {
+			continue
+		}
+		if dryRun {
+			purged += end - begin
+			continue
+		}
+
+		if err := cli.UpdateConsumerOffset(ctx, group, mq, end); err != nil {
+			return purged, err
+		}
+		purged += end - begin
+	}
+	return purged, nil
+}
+
+// purged 返回队列上已清理到的位点, 从未清理过时为队列的最小位点.
+func (d *DeadLetter) purged(ctx context.Context, cli *admin.Client, group string, mq primitive.MessageQueue) (int64, error) {
+	min, err := cli.MinOffset(ctx, mq)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := cli.ConsumerOffset(ctx, group, mq)
+	if admin.IsNotFound(err) {
+		return min, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if offset < min {
+		return min, nil
+	}
+	return offset, nil
+}
+
+// message 还原死信消息, topic 为原始 topic.
+func (v *MessageView) message() *primitive.MessageExt {
+	msg := &primitive.MessageExt{
+		Message: primitive.Message{
+			Topic: v.Topic,
+			Body:  []byte(v.Body),
+		},
+		MsgId:          v.MsgID,
+		OffsetMsgId:    v.OffsetMsgID,
+		BornHost:       v.BornHost,
+		BornTimestamp:  v.BornTimestamp,
+		StoreHost:      v.StoreHost,
+		StoreTimestamp: v.StoreTimestamp,
+		QueueOffset:    v.QueueOffset,
+		ReconsumeTimes: v.ReconsumeTimes,
+	}
+	msg.WithProperties(v.Properties)
+	if topic := v.Properties[propertyRetryTopic]; topic != "" {
+		msg.Topic = topic
+	}
+	msg.Queue = &primitive.MessageQueue{Topic: v.Topic, BrokerName: v.Broker, QueueId: v.QueueID}
+	return msg
+}
+
+// deadLetterMessage 构造转发到自定义死信 topic 的消息, 保留原始 topic 以便重投.
+// 消费与 broker 写入的系统属性同重投一样过滤掉, 只保留 tag, key 与 sharding key.
+func deadLetterMessage(topic string, msg *primitive.MessageExt) *primitive.Message {
+	dlq := primitive.NewMessage(topic, msg.Body)
+	for k, v := range msg.GetProperties() {
+		if !systemProperties[k] {
+			dlq.WithProperty(k, v)
+		}
+	}
+	if tags := msg.GetTags(); tags != "" {
+		dlq.WithTag(tags)
+	}
+	if keys := strings.Fields(msg.GetProperty(propertyKeys)); len(keys) > 0 {
+		dlq.WithKeys(keys)
+	}
+	if key := msg.GetProperty(propertyShardingKey); key != "" {
+		dlq.WithShardingKey(key)
+	}
+	dlq.WithProperty(propertyRetryTopic, msg.Topic)
+	dlq.WithProperty(propertyOriginMessageID, msg.MsgId)
+	return dlq
+}
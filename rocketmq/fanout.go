@@ -0,0 +1,313 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+var errBreakerOpen = errors.New("callback circuit breaker is open")
+
+// deliverFunc 把一批消息回调到 consumerConf 的 callbackURL, 返回每条消息的处理结果.
+type deliverFunc func(ctx context.Context, consumerConf config.Consumer, msgs []*primitive.MessageExt) []error
+
+// fanout 按路由规则把消息分组, 投递到每组消息的回调目标.
+func (c *Consumer) fanout(ctx context.Context, g *group, msgs []*primitive.MessageExt, deliver deliverFunc) []error {
+	type part struct {
+		endpoints []config.Destination
+		msgs      []*primitive.MessageExt
+		index     []int
+	}
+
+	var parts []*part
+	byRoute := make(map[string]*part)
+	for i, msg := range msgs {
+		result := g.router.route(msg)
+		p, ok := byRoute[result.Route]
+		if !ok {
+			p = &part{endpoints: result.Destinations}
+			byRoute[result.Route] = p
+			parts = append(parts, p)
+		}
+		p.msgs = append(p.msgs, msg)
+		p.index = append(p.index, i)
+	}
+	if len(parts) == 1 {
+		return c.fanoutTo(ctx, g, parts[0].endpoints, msgs, deliver)
+	}
+
+	errs := make([]error, len(msgs))
+	var wg sync.WaitGroup
+	for _, p := range parts {
+		wg.Add(1)
+		go func(p *part) {
+			defer wg.Done()
+			for k, err := range c.fanoutTo(ctx, g, p.endpoints, p.msgs, deliver) {
+				errs[p.index[k]] = err
+			}
+		}(p)
+	}
+	wg.Wait()
+	return errs
+}
+
+// fanoutTo 把消息投递到每个回调目标, 按目标的策略合并为每条消息的结果.
+// 每个目标已成功的消息记录在 delivered 中, 整体重试时只投递给未成功的目标.
+func (c *Consumer) fanoutTo(ctx context.Context, g *group, endpoints []config.Destination, msgs []*primitive.MessageExt, deliver deliverFunc) []error {
+	if len(endpoints) == 1 {
+		return g.call(ctx, endpoints[0], msgs, deliver)
+	}
+
+	results := make([][]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, dest := range endpoints {
+		results[i] = make([]error, len(msgs))
+
+		var pending []*primitive.MessageExt
+		var index []int
+		for j, msg := range msgs {
+			if !g.delivered.contains(destinationKey(msg.MsgId, dest)) {
+				pending = append(pending, msg)
+				index = append(index, j)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, dest config.Destination) {
+			defer wg.Done()
+			for k, err := range g.call(ctx, dest, pending, deliver) {
+				results[i][index[k]] = err
+			}
+		}(i, dest)
+	}
+	wg.Wait()
+
+	errs := make([]error, len(msgs))
+	for j, msg := range msgs {
+		errs[j] = g.merge(ctx, endpoints, msg, func(i int) error { return results[i][j] })
+	}
+	return errs
+}
+
+// merge 合并一条消息在每个目标上的结果. 策略为 all 的目标全部成功, 且 any 的目标任一成功时消息成功,
+// 多个目标失败时重试优先于死信.
+func (g *group) merge(ctx context.Context, endpoints []config.Destination, msg *primitive.MessageExt, result func(i int) error) error {
+	var err, anyErr error
+	var hasAny, anyOK bool
+	for i, dest := range endpoints {
+		e := result(i)
+		if outcome := outcomeOf(e); outcome != nil && outcome.Outcome == OutcomeDiscard {
+			log.S(ctx).Infow("message discarded by callback", "groupID", g.conf.GroupID, "msgId", msg.MsgId,
+				"destination", dest.Name, "reason", outcome.Reason)
+			e = nil
+		}
+
+		switch dest.Policy {
+		case config.DeliveryBestEffort:
+			if e != nil {
+				log.S(ctx).Warnw("best effort delivery failed", "groupID", g.conf.GroupID, "msgId", msg.MsgId,
+					"destination", dest.Name, "err", e)
+			}
+			g.delivered.add(destinationKey(msg.MsgId, dest))
+		case config.DeliveryAny:
+			hasAny = true
+			if e == nil {
+				anyOK = true
+			} else {
+				anyErr = preferRetry(anyErr, errors.Wrapf(e, "destination %s", dest.Name))
+			}
+		default:
+			if e == nil {
+				g.delivered.add(destinationKey(msg.MsgId, dest))
+			} else {
+				err = preferRetry(err, errors.Wrapf(e, "destination %s", dest.Name))
+			}
+		}
+	}
+
+	if hasAny {
+		if anyOK {
+			g.delivered.add(destinationKey(msg.MsgId, config.Destination{Policy: config.DeliveryAny}))
+		} else {
+			err = preferRetry(err, anyErr)
+		}
+	}
+
+	if err == nil {
+		for _, dest := range endpoints {
+			g.delivered.remove(destinationKey(msg.MsgId, dest))
+		}
+	}
+	return err
+}
+
+// call 在目标的熔断器与流控允许时投递. 部分失败是业务结果, 全部失败才计为回调失败.
+// 策略不是 all 的目标熔断时直接失败, 不阻塞其他目标.
+func (g *group) call(ctx context.Context, dest config.Destination, msgs []*primitive.MessageExt, deliver deliverFunc) []error {
+	b := g.breakers[dest.Name]
+
+	var errs []error
+	var err error
+	if dest.Policy != config.DeliveryAll && b.open() {
+		err = errors.Wrapf(errBreakerOpen, "destination %s", dest.Name)
+	} else {
+		err = g.guard(ctx, b, func() error {
+			errs = deliver(ctx, destinationConf(g.conf, dest), msgs)
+			for _, err := range errs {
+				if err == nil {
+					return nil
+				}
+			}
+			return errs[0]
+		})
+	}
+
+	if errs == nil {
+		errs = make([]error, len(msgs))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// blocked 策略为 all 的目标熔断, 或 any 的目标全部熔断时暂停消费组.
+func (g *group) blocked() bool {
+	var hasAny, anyOK bool
+	for _, dest := range g.router.endpoints() {
+		open := g.breakers[dest.Name].open()
+		switch dest.Policy {
+		case config.DeliveryBestEffort:
+		case config.DeliveryAny:
+			hasAny = true
+			anyOK = anyOK || !open
+		default:
+			if open {
+				return true
+			}
+		}
+	}
+	return hasAny && !anyOK
+}
+
+func (g *group) uses(b *breaker) bool {
+	for _, gb := range g.breakers {
+		if gb == b {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverEndpoints 不经过熔断与流控, 把消息投递到路由选择的每个回调目标.
+func (c *Consumer) deliverEndpoints(ctx context.Context, consumerConf config.Consumer, msg *primitive.MessageExt) error {
+	r, err := newRouter(consumerConf)
+	if err != nil {
+		return err
+	}
+	endpoints := r.route(msg).Destinations
+
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, dest := range endpoints {
+		wg.Add(1)
+		go func(i int, dest config.Destination) {
+			defer wg.Done()
+			errs[i] = c.deliver(ctx, destinationConf(consumerConf, dest), msg)
+		}(i, dest)
+	}
+	wg.Wait()
+
+	if len(endpoints) == 1 {
+		return errs[0]
+	}
+	g := &group{conf: consumerConf, delivered: newDeliveredSet()}
+	return g.merge(ctx, endpoints, msg, func(i int) error { return errs[i] })
+}
+
+// destinationConf 返回回调到 dest 使用的消费组配置.
+func destinationConf(consumerConf config.Consumer, dest config.Destination) config.Consumer {
+	consumerConf.CallbackURL = dest.CallbackURL
+	consumerConf.HTTP = dest.HTTP
+	consumerConf.GRPC = dest.GRPC
+	consumerConf.Transform = dest.Transform
+	consumerConf.Destinations = nil
+	consumerConf.Routes = nil
+	return consumerConf
+}
+
+// destinationKey 消息在目标上的已投递记录, any 策略的目标共用一条记录.
+func destinationKey(msgID string, dest config.Destination) string {
+	if dest.Policy == config.DeliveryAny {
+		return msgID + "@any"
+	}
+	return msgID + "@" + dest.Name
+}
+
+// preferRetry 需要重试的错误优先于死信.
+func preferRetry(a, b error) error {
+	if a == nil {
+		return b
+	}
+	if outcome := outcomeOf(a); outcome != nil && outcome.Outcome == OutcomeDeadLetter && b != nil {
+		if o := outcomeOf(b); o == nil || o.Outcome != OutcomeDeadLetter {
+			return b
+		}
+	}
+	return a
+}
+
+func validateDestinations(consumerConf config.Consumer) error {
+	if len(consumerConf.Destinations) > 0 && consumerConf.CallbackURL != "" {
+		return errors.New("callbackURL and destinations can not be used together")
+	}
+
+	r, err := newRouter(consumerConf)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, dest := range r.endpoints() {
+		if !isHTTP(dest.CallbackURL) {
+			if _, err := parseGRPCTarget(dest.CallbackURL); err != nil {
+				return errors.Wrapf(err, "destination %s", dest.Name)
+			}
+			if err := validateGRPC(dest.GRPC); err != nil {
+				return errors.Wrapf(err, "destination %s grpc", dest.Name)
+			}
+		}
+		if names[dest.Name] {
+			return errors.Errorf("destination %s declared more than once", dest.Name)
+		}
+		names[dest.Name] = true
+
+		switch dest.Policy {
+		case config.DeliveryAll, config.DeliveryAny, config.DeliveryBestEffort:
+		default:
+			return errors.Errorf("destination %s policy %q, want %s, %s or %s",
+				dest.Name, dest.Policy, config.DeliveryAll, config.DeliveryAny, config.DeliveryBestEffort)
+		}
+
+		if err := validateTransform(dest.Transform); err != nil {
+			return errors.Wrapf(err, "destination %s transform", dest.Name)
+		}
+		if isHTTPDiscovery(dest.CallbackURL) {
+			if _, err := parseHTTPTarget(dest.CallbackURL); err != nil {
+				return errors.Wrapf(err, "destination %s", dest.Name)
+			}
+		}
+		if isHTTP(dest.CallbackURL) {
+			if err := validateHTTP(dest.HTTP); err != nil {
+				return errors.Wrapf(err, "destination %s http", dest.Name)
+			}
+		}
+	}
+	return nil
+}
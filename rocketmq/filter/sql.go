@@ -0,0 +1,481 @@
+// Package filter 实现 RocketMQ SQL92 消息过滤表达式的解析与求值, 语法与 broker 保持一致:
+// 比较 = <> > >= < <=, [NOT] BETWEEN a AND b, [NOT] IN ('a', 'b'), IS [NOT] NULL,
+// AND, OR, NOT 与括号, 常量支持字符串 'abc', 数字(包括 1.5e2 形式)与 TRUE/FALSE.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr 解析后的过滤表达式, 可以并发求值.
+type Expr struct {
+	raw  string
+	root node
+}
+
+// Parse 解析 SQL92 过滤表达式.
+func Parse(sql string) (*Expr, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return &Expr{raw: sql, root: root}, nil
+}
+
+// Match 按消息属性求值, 引用不存在的属性时比较结果为假.
+func (e *Expr) Match(props map[string]string) bool {
+	return e.root.eval(props) == truthTrue
+}
+
+func (e *Expr) String() string {
+	return e.raw
+}
+
+type truth int8
+
+const (
+	truthUnknown truth = iota
+	truthFalse
+	truthTrue
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+func (t truth) not() truth {
+	switch t {
+	case truthTrue:
+		return truthFalse
+	case truthFalse:
+		return truthTrue
+	}
+	return truthUnknown
+}
+
+type node interface {
+	eval(props map[string]string) truth
+}
+
+type operand struct {
+	property string
+	literal  value
+}
+
+func (o operand) value(props map[string]string) value {
+	if o.property == "" {
+		return o.literal
+	}
+	v, ok := props[o.property]
+	if !ok {
+		return value{}
+	}
+	return value{kind: kindString, str: v}
+}
+
+type valueKind int8
+
+const (
+	kindNull valueKind = iota
+	kindString
+	kindNumber
+	kindBool
+)
+
+type value struct {
+	kind valueKind
+	str  string
+	num  float64
+	b    bool
+}
+
+// compare 比较两个值, 属性值按另一侧常量的类型转换, 无法比较时 ok 为 false.
+func compare(l, r value) (cmp int, ok bool) {
+	if l.kind == kindNull || r.kind == kindNull {
+		return 0, false
+	}
+	if l.kind == kindString && r.kind != kindString {
+		if l, ok = convert(l, r.kind); !ok {
+			return 0, false
+		}
+	}
+	if r.kind == kindString && l.kind != kindString {
+		if r, ok = convert(r, l.kind); !ok {
+			return 0, false
+		}
+	}
+	if l.kind != r.kind {
+		return 0, false
+	}
+
+	switch l.kind {
+	case kindNumber:
+		switch {
+		case l.num < r.num:
+			return -1, true
+		case l.num > r.num:
+			return 1, true
+		}
+		return 0, true
+	case kindBool:
+		if l.b == r.b {
+			return 0, true
+		}
+		return 1, true
+	}
+	return strings.Compare(l.str, r.str), true
+}
+
+func convert(v value, kind valueKind) (value, bool) {
+	switch kind {
+	case kindNumber:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+		return value{kind: kindNumber, num: n}, err == nil
+	case kindBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(v.str))
+		return value{kind: kindBool, b: b}, err == nil
+	}
+	return v, true
+}
+
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+func (c *comparison) eval(props map[string]string) truth {
+	cmp, ok := compare(c.left.value(props), c.right.value(props))
+	if !ok {
+		return truthUnknown
+	}
+
+	switch c.op {
+	case "=":
+		return truthOf(cmp == 0)
+	case "<>":
+		return truthOf(cmp != 0)
+	case ">":
+		return truthOf(cmp > 0)
+	case ">=":
+		return truthOf(cmp >= 0)
+	case "<":
+		return truthOf(cmp < 0)
+	case "<=":
+		return truthOf(cmp <= 0)
+	}
+	return truthUnknown
+}
+
+type between struct {
+	not           bool
+	target        operand
+	lower, higher operand
+}
+
+func (b *between) eval(props map[string]string) truth {
+	v := b.target.value(props)
+	lo, ok1 := compare(v, b.lower.value(props))
+	hi, ok2 := compare(v, b.higher.value(props))
+	if !ok1 || !ok2 {
+		return truthUnknown
+	}
+
+	t := truthOf(lo >= 0 && hi <= 0)
+	if b.not {
+		return t.not()
+	}
+	return t
+}
+
+type in struct {
+	not    bool
+	target operand
+	list   []operand
+}
+
+func (n *in) eval(props map[string]string) truth {
+	v := n.target.value(props)
+	if v.kind == kindNull {
+		return truthUnknown
+	}
+
+	t := truthFalse
+	for _, item := range n.list {
+		if cmp, ok := compare(v, item.value(props)); ok && cmp == 0 {
+			t = truthTrue
+			break
+		}
+	}
+	if n.not {
+		return t.not()
+	}
+	return t
+}
+
+type isNull struct {
+	not    bool
+	target operand
+}
+
+func (n *isNull) eval(props map[string]string) truth {
+	t := truthOf(n.target.value(props).kind == kindNull)
+	if n.not {
+		return t.not()
+	}
+	return t
+}
+
+type boolLiteral bool
+
+func (b boolLiteral) eval(map[string]string) truth {
+	return truthOf(bool(b))
+}
+
+type not struct {
+	expr node
+}
+
+func (n *not) eval(props map[string]string) truth {
+	return n.expr.eval(props).not()
+}
+
+type and struct {
+	left, right node
+}
+
+func (a *and) eval(props map[string]string) truth {
+	l := a.left.eval(props)
+	if l == truthFalse {
+		return truthFalse
+	}
+	r := a.right.eval(props)
+	switch {
+	case r == truthFalse:
+		return truthFalse
+	case l == truthTrue && r == truthTrue:
+		return truthTrue
+	}
+	return truthUnknown
+}
+
+type or struct {
+	left, right node
+}
+
+func (o *or) eval(props map[string]string) truth {
+	l := o.left.eval(props)
+	if l == truthTrue {
+		return truthTrue
+	}
+	r := o.right.eval(props)
+	switch {
+	case r == truthTrue:
+		return truthTrue
+	case l == truthFalse && r == truthFalse:
+		return truthFalse
+	}
+	return truthUnknown
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) keyword(word string) bool {
+	if tok := p.peek(); tok.kind == tokIdent && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(word string) error {
+	if !p.keyword(word) {
+		return p.errorf(p.peek(), "expect %s, got %s", word, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return fmt.Errorf("sql92: position %d: %s", tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &or{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &and{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.keyword("NOT") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{expr: expr}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, p.errorf(tok, "expect ), got %s", tok)
+		}
+		return expr, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (node, error) {
+	start := p.peek()
+	if p.keyword("TRUE") {
+		return boolLiteral(true), nil
+	}
+	if p.keyword("FALSE") {
+		return boolLiteral(false), nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind == tokOp {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &comparison{op: tok.text, left: left, right: right}, nil
+	}
+
+	if p.keyword("IS") {
+		negate := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNull{not: negate, target: left}, nil
+	}
+
+	negate := p.keyword("NOT")
+	switch {
+	case p.keyword("BETWEEN"):
+		lower, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		higher, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &between{not: negate, target: left, lower: lower, higher: higher}, nil
+
+	case p.keyword("IN"):
+		if tok := p.next(); tok.kind != tokLParen {
+			return nil, p.errorf(tok, "expect ( after IN, got %s", tok)
+		}
+		var list []operand
+		for {
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if item.property != "" {
+				return nil, p.errorf(start, "IN list only accepts constants")
+			}
+			list = append(list, item)
+
+			tok := p.next()
+			if tok.kind == tokRParen {
+				break
+			}
+			if tok.kind != tokComma {
+				return nil, p.errorf(tok, "expect , or ), got %s", tok)
+			}
+		}
+		return &in{not: negate, target: left, list: list}, nil
+	}
+
+	return nil, p.errorf(p.peek(), "expect comparison after %s, got %s", start, p.peek())
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return operand{literal: value{kind: kindString, str: tok.text}}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return operand{}, p.errorf(tok, "invalid number %s", tok.text)
+		}
+		return operand{literal: value{kind: kindNumber, num: n}}, nil
+	case tokIdent:
+		switch strings.ToUpper(tok.text) {
+		case "TRUE":
+			return operand{literal: value{kind: kindBool, b: true}}, nil
+		case "FALSE":
+			return operand{literal: value{kind: kindBool, b: false}}, nil
+		case "AND", "OR", "NOT", "BETWEEN", "IN", "IS", "NULL":
+			return operand{}, p.errorf(tok, "unexpected keyword %s", tok.text)
+		}
+		return operand{property: tok.text}, nil
+	}
+	return operand{}, p.errorf(tok, "expect property or constant, got %s", tok)
+}
@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	props := map[string]string{
+		"a":      "1",
+		"b":      "x",
+		"n":      "3.5",
+		"quote":  "it's",
+		"region": "cn-north",
+		"flag":   "true",
+	}
+
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		// 比较.
+		{"a = 1", true},
+		{"a <> 1", false},
+		{"a > 0 AND a >= 1 AND a < 2 AND a <= 1", true},
+		{"b = 'x'", true},
+		{"b > 'w'", true},
+		{"flag = TRUE", true},
+		{"region = 'cn-north'", true},
+
+		// 优先级: NOT > AND > OR.
+		{"a = 1 OR b = 'y' AND n = 0", true},
+		{"(a = 1 OR b = 'y') AND n = 0", false},
+		{"b = 'y' AND a = 1 OR n = 3.5", true},
+		{"NOT a = 2 AND b = 'x'", true},
+		{"NOT (a = 1 AND b = 'x')", false},
+		{"TRUE OR FALSE AND FALSE", true},
+
+		// 不存在的属性为 NULL, 比较结果未知, 未知不匹配且 NOT 后仍为未知.
+		{"missing = 1", false},
+		{"NOT missing = 1", false},
+		{"missing <> 1", false},
+		{"missing = 1 OR a = 1", true},
+		{"missing = 1 AND a = 1", false},
+		{"NOT (missing = 1 AND a = 2)", true},
+		{"NOT (missing = 1 OR a = 2)", false},
+		{"missing IS NULL", true},
+		{"missing IS NOT NULL", false},
+		{"a IS NULL", false},
+		{"a IS NOT NULL", true},
+
+		// 属性值无法按常量类型转换时比较结果未知.
+		{"b = 1", false},
+		{"NOT b = 1", false},
+
+		// BETWEEN.
+		{"n BETWEEN 3 AND 4", true},
+		{"n BETWEEN 3.5 AND 3.5", true},
+		{"n BETWEEN 4 AND 5", false},
+		{"n NOT BETWEEN 3 AND 4", false},
+		{"n NOT BETWEEN 4 AND 5", true},
+		{"missing BETWEEN 1 AND 2", false},
+		{"missing NOT BETWEEN 1 AND 2", false},
+
+		// IN.
+		{"b IN ('x', 'y')", true},
+		{"b IN ('y')", false},
+		{"b NOT IN ('y', 'z')", true},
+		{"b NOT IN ('x')", false},
+		{"a IN (1, 2)", true},
+		{"missing IN ('x')", false},
+		{"missing NOT IN ('x')", false},
+
+		// 字符串中两个单引号表示一个单引号.
+		{"quote = 'it''s'", true},
+		{"quote = 'its'", false},
+		{"'''' = ''''", true},
+
+		// 指数形式的数字.
+		{"n = 35e-1", true},
+		{"n = 0.35E1", true},
+		{"n > 1.5e-3", true},
+		{"n < 1e+1", true},
+
+		// 关键字不区分大小写.
+		{"a = 1 and not b = 'y' or n between 0 and 1", true},
+	}
+
+	for _, tt := range tests {
+		expr, err := Parse(tt.sql)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.sql, err)
+			continue
+		}
+		if got := expr.Match(props); got != tt.want {
+			t.Errorf("Parse(%q).Match() = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"", "position 1: expect property or constant, got end of expression"},
+		{"a = ", "position 5: expect property or constant, got end of expression"},
+		{"a = 'x", "position 5: unterminated string"},
+		{"a # 1", "position 3: unexpected character '#'"},
+		{"a = 1 b", "position 7: unexpected b"},
+		{"(a = 1", "position 7: expect ), got end of expression"},
+		{"a", "position 2: expect comparison after a, got end of expression"},
+		{"a BETWEEN 1 2", "position 13: expect AND, got 2"},
+		{"a IS 1", "position 6: expect NULL, got 1"},
+		{"a IN 1", "position 6: expect ( after IN, got 1"},
+		{"a IN ('x' 'y')", "position 11: expect , or ), got 'y'"},
+		{"a IN (b)", "position 1: IN list only accepts constants"},
+		{"a = AND", "position 5: unexpected keyword AND"},
+		{"a = 1.2.3", "position 5: invalid number 1.2.3"},
+		{"a = 1e", "position 6: unexpected e"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.sql)
+		if err == nil {
+			t.Errorf("Parse(%q) error = nil, want %q", tt.sql, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %q, want %q", tt.sql, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/linhoi/mq/internal/config"
+	"golang.org/x/time/rate"
+	"sync"
+)
+
+// flowControl 限制消费组同时进行中的回调数与每秒回调次数, 参数可以在运行中调整.
+type flowControl struct {
+	mu       sync.Mutex
+	conf     config.Flow
+	inflight int
+	released chan struct{} // 有回调结束或参数变更时关闭, 唤醒等待者.
+	limiter  *rate.Limiter
+}
+
+func newFlowControl(conf config.Flow) *flowControl {
+	fc := &flowControl{released: make(chan struct{}), limiter: rate.NewLimiter(rate.Inf, 1)}
+	fc.update(conf)
+	return fc
+}
+
+// acquire 等待回调配额, 成功后需要调用 release.
+func (fc *flowControl) acquire(ctx context.Context) error {
+	for {
+		fc.mu.Lock()
+		if fc.conf.MaxInflight <= 0 || fc.inflight < fc.conf.MaxInflight {
+			fc.inflight++
+			fc.mu.Unlock()
+			break
+		}
+		released := fc.released
+		fc.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := fc.limiter.Wait(ctx); err != nil {
+		fc.release()
+		return err
+	}
+	return nil
+}
+
+func (fc *flowControl) release() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.inflight--
+	fc.wakeLocked()
+}
+
+// update 调整并发与限流参数, 对等待中的回调立即生效.
+func (fc *flowControl) update(conf config.Flow) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.conf = conf
+	if conf.Rate > 0 {
+		fc.limiter.SetLimit(rate.Limit(conf.Rate))
+	} else {
+		fc.limiter.SetLimit(rate.Inf)
+	}
+	fc.wakeLocked()
+}
+
+func (fc *flowControl) config() config.Flow {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	return fc.conf
+}
+
+func (fc *flowControl) wakeLocked() {
+	close(fc.released)
+	fc.released = make(chan struct{})
+}
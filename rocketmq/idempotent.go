@@ -0,0 +1,191 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/go-redis/redis"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq/idempotent"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultIdempotentTTL   = 24 * time.Hour
+	defaultIdempotentLease = time.Minute
+
+	idempotentKeyMsgID    = "msgId"
+	idempotentKeyBusiness = "key"
+	idempotentKeyProperty = "property:"
+)
+
+var errInProgress = errors.New("duplicate message is in progress")
+
+// idempotentGuard 消费组的幂等检查, 回调成功后才标记完成.
+type idempotentGuard struct {
+	group string
+	conf  config.Idempotent
+	store idempotent.Store
+}
+
+// idempotentLocked 返回消费组的幂等检查, 存储在消费组重建时复用.
+func (c *Consumer) idempotentLocked(consumerConf config.Consumer) (*idempotentGuard, error) {
+	conf := consumerConf.Idempotent
+	if conf.TTL <= 0 {
+		conf.TTL = defaultIdempotentTTL
+	}
+	if conf.Lease <= 0 {
+		conf.Lease = defaultIdempotentLease
+	}
+
+	var id string
+	switch conf.Store {
+	case "", config.IdempotentMemory:
+		id = "memory/" + groupKey(consumerConf.Instance, consumerConf.GroupID)
+	case config.IdempotentRedis:
+		id = "redis/" + conf.Redis.Addr + "/" + strconv.Itoa(conf.Redis.DB)
+	case config.IdempotentGorm:
+		id = "gorm/" + gormDialect(conf.Gorm) + "/" + conf.Gorm.DSN + "/" + conf.Gorm.Table
+	}
+
+	store, ok := c.stores[id]
+	if !ok {
+		var err error
+		if store, err = c.newStoreLocked(conf); err != nil {
+			return nil, errors.Wrapf(err, "idempotent store %s", conf.Store)
+		}
+		c.stores[id] = store
+	}
+	return &idempotentGuard{group: consumerConf.GroupID, conf: conf, store: store}, nil
+}
+
+func (c *Consumer) newStoreLocked(conf config.Idempotent) (idempotent.Store, error) {
+	switch conf.Store {
+	case config.IdempotentRedis:
+		client := redis.NewClient(&redis.Options{Addr: conf.Redis.Addr, Password: conf.Redis.Password, DB: conf.Redis.DB})
+		if err := client.Ping().Err(); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		c.cleanup = append(c.cleanup, func() { _ = client.Close() })
+		return idempotent.NewRedis(client), nil
+
+	case config.IdempotentGorm:
+		db, err := gorm.Open(gormDialect(conf.Gorm), conf.Gorm.DSN)
+		if err != nil {
+			return nil, err
+		}
+		store, err := idempotent.NewGorm(db, conf.Gorm.Table)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		c.cleanup = append(c.cleanup, func() { _ = db.Close() })
+		return store, nil
+	}
+	return idempotent.NewMemory(conf.Size), nil
+}
+
+// acquire 获取消息的处理权, 返回需要回调的消息与其在 msgs 中的下标, 以及获取到处理权的 owner.
+// 已处理完成的消息结果为成功, 处理中或存储出错的消息结果为对应的错误, 均不回调.
+func (d *idempotentGuard) acquire(ctx context.Context, msgs []*primitive.MessageExt, errs []error) ([]*primitive.MessageExt, []int, map[string]string) {
+	todo := make([]*primitive.MessageExt, 0, len(msgs))
+	index := make([]int, 0, len(msgs))
+	owners := make(map[string]string, len(msgs))
+	for i, msg := range msgs {
+		owner := newReceipt()
+		state, err := d.store.Acquire(ctx, d.key(msg), owner, d.conf.Lease)
+		switch {
+		case err != nil:
+			errs[i] = err
+		case state == idempotent.Done:
+			log.S(ctx).Infow("duplicate message skipped", "groupID", d.group, "msgId", msg.MsgId, "key", d.key(msg))
+		case state == idempotent.InProgress:
+			errs[i] = errInProgress
+		default:
+			owners[msg.MsgId] = owner
+			todo = append(todo, msg)
+			index = append(index, i)
+		}
+	}
+	return todo, index, owners
+}
+
+// finish 回调成功时标记完成, 否则释放处理权以便重试.
+func (d *idempotentGuard) finish(ctx context.Context, msg *primitive.MessageExt, owners map[string]string, succeeded bool) {
+	owner, ok := owners[msg.MsgId]
+	if !ok {
+		return
+	}
+
+	var err error
+	if succeeded {
+		err = d.store.Done(ctx, d.key(msg), d.conf.TTL)
+	} else {
+		err = d.store.Release(ctx, d.key(msg), owner)
+	}
+	if err != nil {
+		log.S(ctx).Warnw("idempotent store update failed", "groupID", d.group, "msgId", msg.MsgId, "succeeded", succeeded, "err", err)
+	}
+}
+
+// key 幂等记录的键, 配置的业务主键或属性为空时使用 msgId.
+func (d *idempotentGuard) key(msg *primitive.MessageExt) string {
+	var k string
+	switch {
+	case d.conf.Key == idempotentKeyBusiness:
+		if keys := strings.Fields(msg.GetProperty(propertyKeys)); len(keys) > 0 {
+			k = keys[0]
+		}
+	case strings.HasPrefix(d.conf.Key, idempotentKeyProperty):
+		k = msg.GetProperty(strings.TrimPrefix(d.conf.Key, idempotentKeyProperty))
+	}
+	if k == "" {
+		k = msg.MsgId
+	}
+	return "mq:idempotent:" + d.group + ":" + k
+}
+
+func gormDialect(conf config.Gorm) string {
+	if conf.Dialect == "" {
+		return "mysql"
+	}
+	return conf.Dialect
+}
+
+func validateIdempotent(conf config.Idempotent) error {
+	if !conf.Enable {
+		return nil
+	}
+
+	switch {
+	case conf.Key == "", conf.Key == idempotentKeyMsgID, conf.Key == idempotentKeyBusiness:
+	case strings.HasPrefix(conf.Key, idempotentKeyProperty) && len(conf.Key) > len(idempotentKeyProperty):
+	default:
+		return errors.Errorf("key %q, want %s, %s or %s<name>", conf.Key, idempotentKeyMsgID, idempotentKeyBusiness, idempotentKeyProperty)
+	}
+
+	switch conf.Store {
+	case "", config.IdempotentMemory:
+	case config.IdempotentRedis:
+		if conf.Redis.Addr == "" {
+			return errors.New("redis store requires addr")
+		}
+	case config.IdempotentGorm:
+		if conf.Gorm.DSN == "" {
+			return errors.New("gorm store requires dsn")
+		}
+		if d := gormDialect(conf.Gorm); d != "mysql" && d != "postgres" {
+			return errors.Errorf("gorm dialect %s, want mysql or postgres", d)
+		}
+	default:
+		return errors.Errorf("store %s, want %s, %s or %s", conf.Store, config.IdempotentMemory, config.IdempotentRedis, config.IdempotentGorm)
+	}
+	return nil
+}
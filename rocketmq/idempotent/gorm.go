@@ -0,0 +1,85 @@
+package idempotent
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const defaultTable = "mq_idempotent"
+
+// record 处理状态表的一行.
+type record struct {
+	MsgKey   string    `gorm:"column:msg_key;primary_key;type:varchar(255)"`
+	State    int       `gorm:"not null"`
+	Owner    string    `gorm:"type:varchar(64);not null"`
+	ExpireAt time.Time `gorm:"not null;index"`
+}
+
+// gormStore 使用数据库的主键约束标记处理中, 过期的记录在下次获取时覆盖.
+type gormStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewGorm 表不存在时自动创建, table 为空时使用 mq_idempotent.
+func NewGorm(db *gorm.DB, table string) (Store, error) {
+	if table == "" {
+		table = defaultTable
+	}
+	if err := db.Table(table).AutoMigrate(&record{}).Error; err != nil {
+		return nil, errors.Wrapf(err, "migrate %s", table)
+	}
+	return &gormStore{db: db, table: table}, nil
+}
+
+func (g *gormStore) Acquire(ctx context.Context, key, owner string, lease time.Duration) (State, error) {
+	now := time.Now()
+	expire := now.Add(lease)
+
+	// 覆盖过期的记录.
+	res := g.db.Table(g.table).Where("msg_key = ? AND expire_at < ?", key, now).
+		Updates(map[string]interface{}{"state": int(InProgress), "owner": owner, "expire_at": expire})
+	if res.Error != nil {
+		return 0, errors.Wrapf(res.Error, "acquire %s", key)
+	}
+	if res.RowsAffected == 1 {
+		return Acquired, nil
+	}
+
+	insertErr := g.db.Table(g.table).Create(&record{MsgKey: key, State: int(InProgress), Owner: owner, ExpireAt: expire}).Error
+	if insertErr == nil {
+		return Acquired, nil
+	}
+
+	// 插入失败时记录已存在, 按记录的状态返回.
+	var r record
+	if err := g.db.Table(g.table).Where("msg_key = ?", key).First(&r).Error; err != nil {
+		return 0, errors.Wrapf(insertErr, "acquire %s", key)
+	}
+	if State(r.State) == Done {
+		return Done, nil
+	}
+	return InProgress, nil
+}
+
+func (g *gormStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	expire := time.Now().Add(ttl)
+	res := g.db.Table(g.table).Where("msg_key = ?", key).
+		Updates(map[string]interface{}{"state": int(Done), "owner": "", "expire_at": expire})
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "done %s", key)
+	}
+	if res.RowsAffected == 0 {
+		err := g.db.Table(g.table).Create(&record{MsgKey: key, State: int(Done), ExpireAt: expire}).Error
+		return errors.Wrapf(err, "done %s", key)
+	}
+	return nil
+}
+
+func (g *gormStore) Release(ctx context.Context, key, owner string) error {
+	err := g.db.Table(g.table).Where("msg_key = ? AND owner = ? AND state = ?", key, owner, int(InProgress)).
+		Delete(&record{}).Error
+	return errors.Wrapf(err, "release %s", key)
+}
@@ -0,0 +1,91 @@
+package idempotent
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultMemorySize = 100000
+
+// memory 进程内的 LRU 存储, 超过容量时淘汰最久未访问的记录, 只对本进程内的重复消息生效.
+type memory struct {
+	size int
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key    string
+	state  State
+	owner  string
+	expire time.Time
+}
+
+func NewMemory(size int) Store {
+	if size <= 0 {
+		size = defaultMemorySize
+	}
+	return &memory{size: size, ll: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *memory) Acquire(ctx context.Context, key, owner string, lease time.Duration) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := m.entries[key]; ok {
+		e := el.Value.(*entry)
+		if now.Before(e.expire) {
+			m.ll.MoveToFront(el)
+			if e.state == Done {
+				return Done, nil
+			}
+			return InProgress, nil
+		}
+		m.remove(el)
+	}
+
+	m.entries[key] = m.ll.PushFront(&entry{key: key, state: InProgress, owner: owner, expire: now.Add(lease)})
+	for m.ll.Len() > m.size {
+		m.remove(m.ll.Back())
+	}
+	return Acquired, nil
+}
+
+func (m *memory) Done(ctx context.Context, key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.state, e.owner, e.expire = Done, "", time.Now().Add(ttl)
+		m.ll.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = m.ll.PushFront(&entry{key: key, state: Done, expire: time.Now().Add(ttl)})
+	for m.ll.Len() > m.size {
+		m.remove(m.ll.Back())
+	}
+	return nil
+}
+
+func (m *memory) Release(ctx context.Context, key, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		if e := el.Value.(*entry); e.state == InProgress && e.owner == owner {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *memory) remove(el *list.Element) {
+	m.ll.Remove(el)
+	delete(m.entries, el.Value.(*entry).key)
+}
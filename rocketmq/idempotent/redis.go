@@ -0,0 +1,66 @@
+package idempotent
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	redisDone       = "done"
+	redisProcessing = "processing:"
+)
+
+// releaseScript 只删除 owner 自己的处理中标记.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// redisStore 使用 SET NX 标记处理中, 多个实例共享处理状态.
+type redisStore struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+func (r *redisStore) Acquire(ctx context.Context, key, owner string, lease time.Duration) (State, error) {
+	client := r.client.WithContext(ctx)
+	ok, err := client.SetNX(key, redisProcessing+owner, lease).Result()
+	if err != nil {
+		return 0, errors.Wrapf(err, "acquire %s", key)
+	}
+	if ok {
+		return Acquired, nil
+	}
+
+	value, err := client.Get(key).Result()
+	if err == redis.Nil {
+		// 标记恰好过期, 由下一次重试获取.
+		return InProgress, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "get %s", key)
+	}
+	if value == redisDone {
+		return Done, nil
+	}
+	return InProgress, nil
+}
+
+func (r *redisStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	return errors.Wrapf(r.client.WithContext(ctx).Set(key, redisDone, ttl).Err(), "done %s", key)
+}
+
+func (r *redisStore) Release(ctx context.Context, key, owner string) error {
+	err := releaseScript.Run(r.client.WithContext(ctx), []string{key}, redisProcessing+owner).Err()
+	if err != nil && err != redis.Nil {
+		return errors.Wrapf(err, "release %s", key)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package idempotent 记录消息的处理状态, 避免重复投递的消息被重复回调.
+package idempotent
+
+import (
+	"context"
+	"time"
+)
+
+// State 消息的处理状态.
+type State int
+
+const (
+	// Acquired 本次获得处理权, 处理结束后需要调用 Done 或 Release.
+	Acquired State = iota
+	// InProgress 其他消费协程或实例正在处理.
+	InProgress
+	// Done 已处理完成.
+	Done
+)
+
+func (s State) String() string {
+	switch s {
+	case Acquired:
+		return "acquired"
+	case InProgress:
+		return "inProgress"
+	case Done:
+		return "done"
+	}
+	return "unknown"
+}
+
+// Store 处理状态的存储. 处理中的标记在 lease 后过期, 防止处理者异常退出后消息无法再被处理.
+type Store interface {
+	// Acquire 未处理或处理中标记已过期时标记 owner 处理中并返回 Acquired.
+	Acquire(ctx context.Context, key, owner string, lease time.Duration) (State, error)
+	// Done 标记处理完成, 记录保留 ttl.
+	Done(ctx context.Context, key string, ttl time.Duration) error
+	// Release 处理失败时删除 owner 的处理中标记, 消息可以再次处理.
+	Release(ctx context.Context, key, owner string) error
+}
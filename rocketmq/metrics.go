@@ -0,0 +1,52 @@
+package rocketmq
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"net/url"
+)
+
+var (
+	breakerStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mq",
+		Subsystem: "consumer",
+		Name:      "callback_breaker_state",
+		Help:      "Circuit breaker state of a callback, 0 closed, 1 half-open, 2 open. The callback label has userinfo and query removed.",
+	}, []string{"callback"})
+
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mq",
+		Subsystem: "consumer",
+		Name:      "callback_breaker_transitions_total",
+		Help:      "Total number of circuit breaker state changes of a callback.",
+	}, []string{"callback", "from", "to"})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mq",
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "Total number of rocketMQ config reloads by result, success, rejected or rolled_back.",
+	}, []string{"result"})
+
+	configReloadFailed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mq",
+		Subsystem: "config",
+		Name:      "last_reload_failed",
+		Help:      "1 if the last rocketMQ config reload was rejected or rolled back, 0 otherwise.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(breakerStateGauge, breakerTransitions, configReloads, configReloadFailed)
+}
+
+// callbackLabel 去掉回调地址中的用户信息与 query 参数, 避免凭证写入监控, 也避免 query 中变化的 token 产生大量标签.
+func callbackLabel(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
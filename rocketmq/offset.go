@@ -0,0 +1,196 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq/admin"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// 位点重置的目标.
+const (
+	ResetToEarliest  = "earliest"
+	ResetToLatest    = "latest"
+	ResetToTimestamp = "timestamp"
+)
+
+type QueueOffset struct {
+	Topic          string `json:"topic"`
+	Broker         string `json:"broker"`
+	QueueID        int    `json:"queueId"`
+	MinOffset      int64  `json:"minOffset"`
+	MaxOffset      int64  `json:"maxOffset"`
+	ConsumerOffset int64  `json:"consumerOffset"` // -1 表示消费组从未提交过位点.
+	Lag            int64  `json:"lag"`
+}
+
+type ResetOffset struct {
+	QueueOffset
+	PreviousOffset int64 `json:"previousOffset"`
+}
+
+// Offsets 消费组位点的查看与重置.
+type Offsets struct {
+	conf     *config.Config
+	admin    *Admin
+	consumer *Consumer
+}
+
+// NewOffsets consumer 为本进程中运行的消费者, 为 nil 时重置前需要自行停止消费组.
+func NewOffsets(conf *config.Config, admin *Admin, consumer *Consumer) *Offsets {
+	return &Offsets{conf: conf, admin: admin, consumer: consumer}
+}
+
+// Describe 返回消费组在 topic 各队列上的位点与堆积, topic 为空时返回配置中订阅的所有 topic.
+func (o *Offsets) Describe(ctx context.Context, instance, group, topic string) ([]*QueueOffset, error) {
+	cli, err := o.admin.client(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := []string{topic}
+	if topic == "" {
+		consumerConf, ok := o.consumerConf(instance, group)
+		if !ok {
+			return nil, errors.Errorf("consumer groupID(%s) not configured on instance %s, topic is required", group, getInstance(instance))
+		}
+		topics = topics[:0]
+		for _, t := range consumerConf.Targets {
+			topics = append(topics, t.Topic)
+		}
+	}
+
+	var offsets []*QueueOffset
+	for _, topic := range topics {
+		mqs, err := cli.Queues(ctx, topic)
+		if err != nil {
+			return nil, err
+		}
+		for _, mq := range mqs {
+			offset, err := o.describe(ctx, cli, group, mq)
+			if err != nil {
+				return nil, err
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets, nil
+}
+
+// Reset 把消费组在 topic 各队列上的位点重置到 to, to 为 ResetToTimestamp 时重置到 t 之后的第一条消息.
+// 本进程中运行的该消费组会先停止, 重置后再启动. 其他进程中在线的同组消费者需要先停止, 否则会用内存中的位点覆盖重置结果.
+func (o *Offsets) Reset(ctx context.Context, instance, group, topic, to string, t time.Time, dryRun bool) (resets []*ResetOffset, err error) {
+	if group == "" || topic == "" {
+		return nil, errors.New("group and topic are required")
+	}
+	if to != ResetToEarliest && to != ResetToLatest && to != ResetToTimestamp {
+		return nil, errors.Errorf("reset to %q, want %s, %s or %s", to, ResetToEarliest, ResetToLatest, ResetToTimestamp)
+	}
+	if to == ResetToTimestamp && t.IsZero() {
+		return nil, errors.New("timestamp is required")
+	}
+	if consumerConf, ok := o.consumerConf(instance, group); ok && consumerConf.Broadcasting() {
+		return nil, errors.Errorf("consumer groupID(%s) is broadcasting, offsets are stored locally", group)
+	}
+
+	cli, err := o.admin.client(instance)
+	if err != nil {
+		return nil, err
+	}
+	mqs, err := cli.Queues(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先算出所有队列的目标位点, 避免停止消费组后才失败.
+	for _, mq := range mqs {
+		offset, err := o.describe(ctx, cli, group, mq)
+		if err != nil {
+			return nil, err
+		}
+
+		reset := &ResetOffset{QueueOffset: *offset, PreviousOffset: offset.ConsumerOffset}
+		switch to {
+		case ResetToEarliest:
+			reset.ConsumerOffset = offset.MinOffset
+		case ResetToLatest:
+			reset.ConsumerOffset = offset.MaxOffset
+		default:
+			if reset.ConsumerOffset, err = cli.SearchOffset(ctx, mq, t); err != nil {
+				return nil, err
+			}
+		}
+		reset.Lag = reset.MaxOffset - reset.ConsumerOffset
+		resets = append(resets, reset)
+	}
+	if dryRun {
+		return resets, nil
+	}
+
+	if consumerConf, ok := o.consumer.running(instance, group); ok {
+		if err := o.consumer.StopGroup(instance, group); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if startErr := o.consumer.StartGroup(consumerConf); startErr != nil && err == nil {
+				err = errors.Wrapf(startErr, "restart consumer groupID(%s) after reset", group)
+			}
+		}()
+	}
+
+	for i, reset := range resets {
+		mq := primitive.MessageQueue{Topic: reset.Topic, BrokerName: reset.Broker, QueueId: reset.QueueID}
+		if err := cli.UpdateConsumerOffset(ctx, group, mq, reset.ConsumerOffset); err != nil {
+			return resets[:i], errors.Wrapf(err, "reset %s queue %d", reset.Broker, reset.QueueID)
+		}
+	}
+
+	log.S(ctx).Infow("consumer offsets reset", "groupID", group, "topic", topic, "to", to, "timestamp", t, "queues", len(resets))
+	return resets, nil
+}
+
+func (o *Offsets) describe(ctx context.Context, cli *admin.Client, group string, mq primitive.MessageQueue) (*QueueOffset, error) {
+	min, err := cli.MinOffset(ctx, mq)
+	if err != nil {
+		return nil, err
+	}
+	max, err := cli.MaxOffset(ctx, mq)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := &QueueOffset{
+		Topic:          mq.Topic,
+		Broker:         mq.BrokerName,
+		QueueID:        mq.QueueId,
+		MinOffset:      min,
+		MaxOffset:      max,
+		ConsumerOffset: -1,
+		Lag:            max - min,
+	}
+
+	consumed, err := cli.ConsumerOffset(ctx, group, mq)
+	if admin.IsNotFound(err) {
+		return offset, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	offset.ConsumerOffset = consumed
+	if consumed > min {
+		offset.Lag = max - consumed
+	}
+	return offset, nil
+}
+
+func (o *Offsets) consumerConf(instance, group string) (config.Consumer, bool) {
+	for _, c := range o.conf.RocketMQ.Consumers {
+		if c.GroupID == group && getInstance(c.Instance) == getInstance(instance) {
+			return c, true
+		}
+	}
+	return config.Consumer{}, false
+}
@@ -0,0 +1,88 @@
+package rocketmq
+
+import (
+	"fmt"
+	mq "github.com/linhoi/mq/protobuf"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// 回调结果, 即 HTTP 回调响应的 outcome 字段.
+const (
+	OutcomeSuccess    = "success"
+	OutcomeRetry      = "retry"
+	OutcomeDiscard    = "discard"
+	OutcomeDeadLetter = "deadLetter"
+
+	// OutcomeBackoff 只用于状态码映射, 按响应的 Retry-After 延迟重试.
+	OutcomeBackoff = "backoff"
+)
+
+// OutcomeError 回调明确返回的非成功结果.
+type OutcomeError struct {
+	Outcome    string
+	DelayLevel int // 重试的延迟级别, 0 表示按消费组的重试策略.
+	Reason     string
+}
+
+func (e *OutcomeError) Error() string {
+	if e.Outcome == OutcomeRetry && e.DelayLevel > 0 {
+		return fmt.Sprintf("callback outcome %s at delay level %d: %s", e.Outcome, e.DelayLevel, e.Reason)
+	}
+	return fmt.Sprintf("callback outcome %s: %s", e.Outcome, e.Reason)
+}
+
+// newOutcome 成功时返回 nil. delayLevel 优先于 retryAfter, 都为0时按消费组的重试策略.
+func newOutcome(outcome string, retryAfter time.Duration, level int, reason string) error {
+	switch outcome {
+	case "", OutcomeSuccess:
+		return nil
+	case OutcomeRetry:
+		if level <= 0 && retryAfter > 0 {
+			level = delayLevel(retryAfter)
+		}
+		if level > maxDelayLevel {
+			level = maxDelayLevel
+		}
+		if level < 0 {
+			level = 0
+		}
+	case OutcomeDiscard, OutcomeDeadLetter:
+	default:
+		return errors.Errorf("unknown callback outcome %q: %s", outcome, reason)
+	}
+	return &OutcomeError{Outcome: outcome, DelayLevel: level, Reason: reason}
+}
+
+func grpcOutcome(outcome mq.Outcome, retryAfterSeconds, level int32, reason string) error {
+	var o string
+	switch outcome {
+	case mq.Outcome_OUTCOME_SUCCESS:
+		o = OutcomeSuccess
+	case mq.Outcome_OUTCOME_RETRY:
+		o = OutcomeRetry
+	case mq.Outcome_OUTCOME_DISCARD:
+		o = OutcomeDiscard
+	case mq.Outcome_OUTCOME_DEAD_LETTER:
+		o = OutcomeDeadLetter
+	default:
+		o = outcome.String()
+	}
+	return newOutcome(o, time.Duration(retryAfterSeconds)*time.Second, int(level), reason)
+}
+
+func outcomeOf(err error) *OutcomeError {
+	var oe *OutcomeError
+	if errors.As(err, &oe) {
+		return oe
+	}
+	return nil
+}
+
+// callbackFailed 丢弃与进入死信是回调的正常处理结果, 不计入熔断器的失败.
+func callbackFailed(err error) error {
+	if oe := outcomeOf(err); oe != nil && oe.Outcome != OutcomeRetry {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package rocketmq
+
+import (
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	mq "github.com/linhoi/mq/protobuf"
+	"strconv"
+	"strings"
+)
+
+// PayloadVersion 回调消息体的版本, HTTP 与 gRPC 回调使用同一版本.
+const PayloadVersion = "v1"
+
+const (
+	propertyKeys        = "KEYS"
+	propertyTags        = "TAGS"
+	propertyShardingKey = "__SHARDINGKEY"
+)
+
+// systemProperties RocketMQ 内部使用的属性, 不作为用户属性下发.
+var systemProperties = map[string]bool{
+	propertyKeys:                     true,
+	propertyTags:                     true,
+	propertyShardingKey:              true,
+	"UNIQ_KEY":                       true,
+	"WAIT":                           true,
+	"DELAY":                          true,
+	"RETRY_TOPIC":                    true,
+	"REAL_TOPIC":                     true,
+	"REAL_QID":                       true,
+	"TRAN_MSG":                       true,
+	"PGROUP":                         true,
+	"MIN_OFFSET":                     true,
+	"MAX_OFFSET":                     true,
+	"CLUSTER":                        true,
+	"MSG_REGION":                     true,
+	"TRACE_ON":                       true,
+	"ORIGIN_MESSAGE_ID":              true,
+	"RECONSUME_TIME":                 true,
+	"MAX_RECONSUME_TIMES":            true,
+	"CONSUME_START_TIME":             true,
+	"INSTANCE_ID":                    true,
+	"TRANSACTION_CHECK_TIMES":        true,
+	"CHECK_IMMUNITY_TIME_IN_SECONDS": true,
+}
+
+// Payload HTTP 回调的请求体. 单条回调填充 Message, 批量回调填充 Messages.
+// Topic, TransactionId, Body 为 v1 之前的字段, 保留以兼容旧的接收方.
+type Payload struct {
+	Version  string            `json:"version"`
+	Message  *PayloadMessage   `json:"message,omitempty"`
+	Messages []*PayloadMessage `json:"messages,omitempty"`
+
+	Topic         string `json:"topic,omitempty"`
+	TransactionId string `json:"transactionId,omitempty"`
+	Body          []byte `json:"body,omitempty"`
+}
+
+// PayloadMessage 回调下发的消息及其元数据.
+type PayloadMessage struct {
+	MsgID          string            `json:"msgId"`
+	Topic          string            `json:"topic"`
+	Tags           string            `json:"tags"`
+	Keys           []string          `json:"keys"`
+	Properties     map[string]string `json:"properties"`
+	ShardingKey    string            `json:"shardingKey"`
+	BornHost       string            `json:"bornHost"`
+	BornTimestamp  int64             `json:"bornTimestamp"`
+	StoreHost      string            `json:"storeHost"`
+	StoreTimestamp int64             `json:"storeTimestamp"`
+	QueueID        int               `json:"queueId"`
+	QueueOffset    int64             `json:"queueOffset"`
+	ReconsumeTimes int32             `json:"reconsumeTimes"`
+	Body           string            `json:"body"`
+}
+
+func newPayload(msg *primitive.MessageExt) *Payload {
+	return &Payload{
+		Version:       PayloadVersion,
+		Message:       newPayloadMessage(msg),
+		Topic:         msg.Topic,
+		TransactionId: msg.TransactionId,
+		Body:          msg.Body,
+	}
+}
+
+func newBatchPayload(msgs []*primitive.MessageExt) *Payload {
+	p := &Payload{Version: PayloadVersion, Messages: make([]*PayloadMessage, len(msgs))}
+	for i, msg := range msgs {
+		p.Messages[i] = newPayloadMessage(msg)
+	}
+	return p
+}
+
+func newPayloadMessage(msg *primitive.MessageExt) *PayloadMessage {
+	props := make(map[string]string)
+	for k, v := range msg.GetProperties() {
+		if !systemProperties[k] {
+			props[k] = v
+		}
+	}
+
+	p := &PayloadMessage{
+		MsgID:          msg.MsgId,
+		Topic:          msg.Topic,
+		Tags:           msg.GetProperty(propertyTags),
+		Keys:           strings.Fields(msg.GetProperty(propertyKeys)),
+		Properties:     props,
+		ShardingKey:    msg.GetProperty(propertyShardingKey),
+		BornHost:       msg.BornHost,
+		BornTimestamp:  msg.BornTimestamp,
+		StoreHost:      msg.StoreHost,
+		StoreTimestamp: msg.StoreTimestamp,
+		QueueOffset:    msg.QueueOffset,
+		ReconsumeTimes: msg.ReconsumeTimes,
+		Body:           string(msg.Body),
+	}
+	if msg.Queue != nil {
+		p.QueueID = msg.Queue.QueueId
+	}
+	return p
+}
+
+func grpcMessage(msg *primitive.MessageExt) *mq.Message {
+	p := newPayloadMessage(msg)
+	return &mq.Message{
+		Topic:          p.Topic,
+		Tag:            p.Tags,
+		Key:            strings.Join(p.Keys, " "),
+		Keys:           p.Keys,
+		ShardingKey:    p.ShardingKey,
+		Properties:     p.Properties,
+		Body:           p.Body,
+		MsgId:          p.MsgID,
+		BornHost:       p.BornHost,
+		BornTs:         strconv.FormatInt(p.BornTimestamp, 10),
+		StoreHost:      p.StoreHost,
+		StoreTs:        strconv.FormatInt(p.StoreTimestamp, 10),
+		QueueId:        int32(p.QueueID),
+		QueueOffset:    p.QueueOffset,
+		ReconsumeTimes: p.ReconsumeTimes,
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"github.com/linhoi/mq/internal/config"
 	mq "github.com/linhoi/mq/protobuf"
 	"github.com/pkg/errors"
+	"sync"
 )
 
 type Producer struct {
+	mu        sync.RWMutex
 	producers map[string]rocketmq.Producer
 }
 
@@ -22,22 +24,9 @@ const (
 func NewProducer(conf *config.Config) (*Producer, func(), error) {
 	pc := make(map[string]rocketmq.Producer)
 	for _, ins := range conf.RocketMQ.Instances {
-		p, err := rocketmq.NewProducer(
-			producer.WithGroupName(ins.GroupID),
-			producer.WithNameServerDomain(ins.NameServer),
-			producer.WithCredentials(primitive.Credentials{
-				AccessKey:     ins.Credentials.AccessKey,
-				SecretKey:     ins.Credentials.SecretKey,
-				SecurityToken: "",
-			}))
-
-		if err != nil {
-			return nil, func() {}, errors.WithStack(err)
-		}
-
-		err = p.Start()
+		p, err := startProducer(ins)
 		if err != nil {
-			return nil, func() {}, errors.WithStack(err)
+			return nil, func() {}, err
 		}
 
 		pc[ins.Name] = p
@@ -50,7 +39,31 @@ func NewProducer(conf *config.Config) (*Producer, func(), error) {
 	}, nil
 }
 
+func startProducer(ins config.Instance) (rocketmq.Producer, error) {
+	p, err := rocketmq.NewProducer(
+		producer.WithGroupName(ins.GroupID),
+		producer.WithNameServerDomain(ins.NameServer),
+		producer.WithCredentials(primitive.Credentials{
+			AccessKey:     ins.Credentials.AccessKey,
+			SecretKey:     ins.Credentials.SecretKey,
+			SecurityToken: "",
+		}))
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = p.Start()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return p, nil
+}
+
 func (p *Producer) Shutdown() {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	for _, p := range p.producers {
 		if err := p.Shutdown(); err != nil {
 			log.S(context.Background()).Warnw("producer shutdown", "err", err)
@@ -58,6 +71,20 @@ func (p *Producer) Shutdown() {
 	}
 }
 
+// swap 替换实例的 producer 并返回原来的 producer, pc 为 nil 时移除该实例.
+func (p *Producer) swap(instance string, pc rocketmq.Producer) rocketmq.Producer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	old := p.producers[instance]
+	if pc == nil {
+		delete(p.producers, instance)
+	} else {
+		p.producers[instance] = pc
+	}
+	return old
+}
+
 func (p *Producer) GRPCHandle(ctx context.Context, msg *mq.Message) (*primitive.SendResult, error) {
 	mqMsg := &primitive.Message{Topic: msg.Topic, Body: []byte(msg.Body)}
 
@@ -72,7 +99,20 @@ func (p *Producer) GRPCHandle(ctx context.Context, msg *mq.Message) (*primitive.
 	return resp, err
 }
 
+// Send 通过指定实例同步发送消息.
+func (p *Producer) Send(ctx context.Context, instance string, msg *primitive.Message) (*primitive.SendResult, error) {
+	pc, err := p.getProducer(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return pc.SendSync(ctx, msg)
+}
+
 func (p *Producer) getProducer(instance string) (rocketmq.Producer, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if pc, ok := p.producers[getInstance(instance)]; ok {
 		return pc, nil
 	}
@@ -0,0 +1,262 @@
+package rocketmq
+
+import (
+	"context"
+	rocketmq "github.com/apache/rocketmq-client-go/v2"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+)
+
+// 配置热更新的结果.
+const (
+	reloadSuccess    = "success"
+	reloadRejected   = "rejected"
+	reloadRolledBack = "rolled_back"
+)
+
+// Reconciler 对比热更新前后的 rocketMQ 配置, 只启停或重建受影响的实例 producer 与消费组.
+// 一次变更中任一步骤失败时按相反顺序撤销已执行的步骤, 恢复到变更前的状态并告警.
+type Reconciler struct {
+	producer *Producer
+	consumer *Consumer
+	admin    *Admin
+
+	mu      sync.Mutex
+	applied config.RocketMQ // 当前生效的配置.
+}
+
+func NewReconciler(conf *config.Config, watcher *config.Watcher, producer *Producer, consumer *Consumer, admin *Admin) *Reconciler {
+	r := &Reconciler{producer: producer, consumer: consumer, admin: admin, applied: conf.RocketMQ}
+	watcher.Subscribe(r.reconcile)
+	return r
+}
+
+func (r *Reconciler) reconcile(conf *config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, next := r.applied, conf.RocketMQ
+	if reflect.DeepEqual(prev.Instances, next.Instances) && reflect.DeepEqual(prev.Consumers, next.Consumers) {
+		return
+	}
+
+	if err := validateConsumers(next.Consumers); err != nil {
+		r.alert(reloadRejected, err)
+		return
+	}
+
+	tx := &reconcileTx{}
+	if err := r.apply(tx, prev, next); err != nil {
+		tx.rollback()
+		r.alert(reloadRolledBack, err)
+		return
+	}
+	tx.commit()
+
+	r.applied = next
+	r.consumer.setConsumers(next.Consumers)
+	configReloads.WithLabelValues(reloadSuccess).Inc()
+	configReloadFailed.Set(0)
+	log.S(context.Background()).Infow("rocketMQ config reloaded")
+}
+
+func (r *Reconciler) alert(result string, err error) {
+	configReloads.WithLabelValues(result).Inc()
+	configReloadFailed.Set(1)
+	log.S(context.Background()).Errorw("rocketMQ config reload failed, keep running with previous config", "result", result, "err", err)
+}
+
+func (r *Reconciler) apply(tx *reconcileTx, prev, next config.RocketMQ) error {
+	prevIns, nextIns := instancesByName(prev.Instances), instancesByName(next.Instances)
+
+	// 新增或变更的实例先启动新的 producer, 变更生效后再关闭旧的.
+	changed := make(map[string]bool)
+	for name, ins := range nextIns {
+		if old, ok := prevIns[name]; ok && old == ins {
+			continue
+		}
+		changed[name] = true
+
+		if err := r.swapProducer(tx, ins); err != nil {
+			return err
+		}
+	}
+	r.consumer.setInstances(next.Instances)
+	tx.undo(func() { r.consumer.setInstances(prev.Instances) })
+
+	if r.consumer.isStarted() {
+		if err := r.applyConsumers(tx, prev.Consumers, next.Consumers, changed); err != nil {
+			return err
+		}
+	}
+
+	// 查询, 死信与位点管理使用变更后的实例.
+	if len(changed) > 0 || len(prevIns) != len(nextIns) {
+		tx.onCommit(func() { r.admin.setInstances(next.Instances) })
+	}
+
+	for name := range prevIns {
+		if _, ok := nextIns[name]; ok {
+			continue
+		}
+		name := name
+		tx.onCommit(func() {
+			if pc := r.producer.swap(name, nil); pc != nil {
+				shutdownProducer(name, pc)
+			}
+			log.S(context.Background()).Infow("producer removed", "instance", name)
+		})
+	}
+	return nil
+}
+
+func (r *Reconciler) swapProducer(tx *reconcileTx, ins config.Instance) error {
+	pc, err := startProducer(ins)
+	if err != nil {
+		return errors.Wrapf(err, "start producer of instance %s", ins.Name)
+	}
+
+	old := r.producer.swap(ins.Name, pc)
+	tx.undo(func() {
+		r.producer.swap(ins.Name, old)
+		shutdownProducer(ins.Name, pc)
+	})
+	if old != nil {
+		tx.onCommit(func() { shutdownProducer(ins.Name, old) })
+	}
+	log.S(context.Background()).Infow("producer started", "instance", ins.Name)
+	return nil
+}
+
+// applyConsumers 先停止移除的消费组, 再重建变更的消费组, 最后启动新增的消费组.
+// 只有流控参数变化的消费组直接更新, 不重建. instances 为变更过的实例, 其上的消费组需要重建.
+func (r *Reconciler) applyConsumers(tx *reconcileTx, prev, next []config.Consumer, instances map[string]bool) error {
+	prevByKey, nextByKey := consumersByKey(prev), consumersByKey(next)
+
+	for key, old := range prevByKey {
+		if _, ok := nextByKey[key]; ok {
+			continue
+		}
+		if err := r.stopGroup(tx, old); err != nil {
+			return err
+		}
+	}
+
+	for key, conf := range nextByKey {
+		old, ok := prevByKey[key]
+		restart := instances[getInstance(conf.Instance)]
+		if !ok || (!restart && reflect.DeepEqual(old, conf)) {
+			continue
+		}
+
+		if !restart && flowOnly(old, conf) && r.consumer.updateFlow(conf) {
+			old := old
+			tx.undo(func() { r.consumer.updateFlow(old) })
+			continue
+		}
+
+		if err := r.stopGroup(tx, old); err != nil {
+			return err
+		}
+		if err := r.startGroup(tx, conf); err != nil {
+			return err
+		}
+	}
+
+	for key, conf := range nextByKey {
+		if _, ok := prevByKey[key]; ok {
+			continue
+		}
+		if err := r.startGroup(tx, conf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) stopGroup(tx *reconcileTx, conf config.Consumer) error {
+	running, ok := r.consumer.running(conf.Instance, conf.GroupID)
+	if !ok {
+		return nil
+	}
+	if err := r.consumer.StopGroup(conf.Instance, conf.GroupID); err != nil {
+		return err
+	}
+
+	tx.undo(func() {
+		if err := r.consumer.StartGroup(running); err != nil {
+			log.S(context.Background()).Errorw("rollback consumer failed", "groupID", running.GroupID, "err", err)
+		}
+	})
+	return nil
+}
+
+func (r *Reconciler) startGroup(tx *reconcileTx, conf config.Consumer) error {
+	if err := r.consumer.StartGroup(conf); err != nil {
+		return err
+	}
+
+	tx.undo(func() {
+		if err := r.consumer.StopGroup(conf.Instance, conf.GroupID); err != nil {
+			log.S(context.Background()).Errorw("rollback consumer failed", "groupID", conf.GroupID, "err", err)
+		}
+	})
+	return nil
+}
+
+// flowOnly 两个消费组配置只有流控参数不同.
+func flowOnly(a, b config.Consumer) bool {
+	a.Flow = b.Flow
+	return reflect.DeepEqual(a, b)
+}
+
+func instancesByName(instances []config.Instance) map[string]config.Instance {
+	m := make(map[string]config.Instance, len(instances))
+	for _, ins := range instances {
+		m[ins.Name] = ins
+	}
+	return m
+}
+
+func consumersByKey(consumers []config.Consumer) map[string]config.Consumer {
+	m := make(map[string]config.Consumer, len(consumers))
+	for _, c := range consumers {
+		m[groupKey(c.Instance, c.GroupID)] = c
+	}
+	return m
+}
+
+func shutdownProducer(instance string, pc rocketmq.Producer) {
+	if err := pc.Shutdown(); err != nil {
+		log.S(context.Background()).Warnw("producer shutdown", "instance", instance, "err", err)
+	}
+}
+
+// reconcileTx 记录一次变更中已执行步骤的撤销操作, 以及变更成功后才执行的清理.
+type reconcileTx struct {
+	undos   []func()
+	commits []func()
+}
+
+func (tx *reconcileTx) undo(fn func()) {
+	tx.undos = append(tx.undos, fn)
+}
+
+func (tx *reconcileTx) onCommit(fn func()) {
+	tx.commits = append(tx.commits, fn)
+}
+
+func (tx *reconcileTx) rollback() {
+	for i := len(tx.undos) - 1; i >= 0; i-- {
+		tx.undos[i]()
+	}
+}
+
+func (tx *reconcileTx) commit() {
+	for _, fn := range tx.commits {
+		fn()
+	}
+}
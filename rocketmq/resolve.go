@@ -0,0 +1,187 @@
+package rocketmq
+
+import (
+	"context"
+	"github.com/linhoi/mq/external/gclient/resolver/consul"
+	"github.com/linhoi/mq/external/gclient/resolver/dns"
+	"github.com/linhoi/mq/external/gclient/resolver/static"
+	"github.com/linhoi/mq/external/log"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const addrTTL = 10 * time.Second // 回调地址解析结果的缓存时间.
+
+// addrResolver 解析 dns://, consul:// 与 static:// 回调目标的全部后端地址, 解析失败时沿用上次的结果.
+// onRemove 在刷新后不再被任何回调目标解析到的地址上调用.
+type addrResolver struct {
+	mu       sync.Mutex
+	cache    map[string]resolvedAddrs
+	onRemove func(removed []string)
+}
+
+type resolvedAddrs struct {
+	addrs  []string
+	expire time.Time
+}
+
+func newAddrResolver(onRemove func(removed []string)) *addrResolver {
+	return &addrResolver{cache: make(map[string]resolvedAddrs), onRemove: onRemove}
+}
+
+func (r *addrResolver) resolve(ctx context.Context, url string) ([]string, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[url]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expire) {
+		return cached.addrs, nil
+	}
+
+	var (
+		addrs []string
+		err   error
+	)
+	switch {
+	case strings.HasPrefix(url, "dns://"):
+		addrs, err = dns.Lookup(ctx, url)
+	case strings.HasPrefix(url, "consul://"):
+		addrs, err = consul.Lookup(ctx, url)
+	case strings.HasPrefix(url, "static://"):
+		addrs, err = static.Lookup(url)
+	default:
+		return nil, errors.Errorf("callbackURL %s can not be resolved", url)
+	}
+	if err == nil && len(addrs) == 0 {
+		err = errors.Errorf("no address resolved from %s", url)
+	}
+	if err != nil {
+		if ok {
+			log.S(ctx).Warnw("resolve callback failed, use last addresses", "callback", url, "addrs", cached.addrs, "err", err)
+			return cached.addrs, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	removed := r.removedLocked(url, addrs)
+	r.cache[url] = resolvedAddrs{addrs: addrs, expire: time.Now().Add(addrTTL)}
+	r.mu.Unlock()
+	if len(removed) > 0 && r.onRemove != nil {
+		log.S(ctx).Infow("callback addresses removed", "callback", url, "addrs", removed)
+		r.onRemove(removed)
+	}
+	return addrs, nil
+}
+
+// removedLocked 返回 url 上次解析到, 这次与其他回调目标都没有解析到的地址.
+func (r *addrResolver) removedLocked(url string, addrs []string) []string {
+	last, ok := r.cache[url]
+	if !ok {
+		return nil
+	}
+	current := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		current[addr] = true
+	}
+	for other, resolved := range r.cache {
+		if other == url {
+			continue
+		}
+		for _, addr := range resolved.addrs {
+			current[addr] = true
+		}
+	}
+
+	var removed []string
+	for _, addr := range last.addrs {
+		if !current[addr] {
+			removed = append(removed, addr)
+		}
+	}
+	return removed
+}
+
+func isDiscovery(url string) bool {
+	return strings.HasPrefix(url, "dns://") || strings.HasPrefix(url, "consul://") || strings.HasPrefix(url, "static://")
+}
+
+// grpcTarget gRPC 回调目标对应的 resolver scheme, authority 与 endpoint.
+type grpcTarget struct {
+	scheme    string
+	authority string
+	endpoint  string
+}
+
+// parseGRPCTarget 解析 gRPC 回调地址, 支持 grpc://host:port, dns://[authority]/host:port,
+// consul://[user:passwd@]agent/service?tag=.. 与 static:///host1:port1,host2:port2.
+func parseGRPCTarget(rawURL string) (grpcTarget, error) {
+	i := strings.Index(rawURL, "://")
+	if i < 0 {
+		return grpcTarget{}, errors.Errorf("callbackURL %q must be scheme://...", rawURL)
+	}
+	scheme, rest := rawURL[:i], rawURL[i+3:]
+
+	switch scheme {
+	case "grpc":
+		if err := checkHostPort(rest); err != nil {
+			return grpcTarget{}, errors.Wrapf(err, "callbackURL %q, want grpc://host:port", rawURL)
+		}
+		return grpcTarget{scheme: "passthrough", endpoint: rest}, nil
+
+	case dns.Scheme:
+		j := strings.Index(rest, "/")
+		if j < 0 {
+			return grpcTarget{}, errors.Errorf("callbackURL %q, want dns://[authority]/host:port", rawURL)
+		}
+		authority, endpoint := rest[:j], rest[j+1:]
+		if strings.Contains(authority, ":") {
+			if err := checkHostPort(authority); err != nil {
+				return grpcTarget{}, errors.Wrapf(err, "callbackURL %q authority", rawURL)
+			}
+		}
+		if err := checkHostPort(endpoint); err != nil {
+			return grpcTarget{}, errors.Wrapf(err, "callbackURL %q, want dns://[authority]/host:port", rawURL)
+		}
+		return grpcTarget{scheme: dns.Scheme, authority: authority, endpoint: endpoint}, nil
+
+	case "consul":
+		if err := consul.Validate(rawURL); err != nil {
+			return grpcTarget{}, err
+		}
+		u, _ := url.Parse(rawURL)
+		authority := u.Host
+		if u.User != nil {
+			authority = u.User.String() + "@" + authority
+		}
+		endpoint := strings.TrimLeft(u.Path, "/")
+		if u.RawQuery != "" {
+			endpoint += "?" + u.RawQuery
+		}
+		return grpcTarget{scheme: "consul", authority: authority, endpoint: endpoint}, nil
+
+	case static.Scheme:
+		if !strings.HasPrefix(rest, "/") {
+			return grpcTarget{}, errors.Errorf("callbackURL %q, want static:///host1:port1,host2:port2", rawURL)
+		}
+		if _, err := static.Parse(rest[1:]); err != nil {
+			return grpcTarget{}, errors.Wrapf(err, "callbackURL %q", rawURL)
+		}
+		return grpcTarget{scheme: static.Scheme, endpoint: rest[1:]}, nil
+	}
+	return grpcTarget{}, errors.Errorf("unsupported callbackURL %q", rawURL)
+}
+
+func checkHostPort(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" || port == "" {
+		return errors.Errorf("address %q must be host:port", addr)
+	}
+	return nil
+}
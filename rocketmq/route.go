@@ -0,0 +1,136 @@
+package rocketmq
+
+import (
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/linhoi/mq/rocketmq/filter"
+	"github.com/pkg/errors"
+	"path"
+	"strings"
+)
+
+// router 按消费组的路由规则选择消息的回调目标.
+type router struct {
+	routes   []route
+	fallback []config.Destination
+}
+
+type route struct {
+	name     string
+	tags     map[string]bool
+	keys     string
+	expr     *filter.Expr
+	endpoint config.Destination
+}
+
+// RouteResult 消息匹配的路由, Route 为空表示使用默认回调目标.
+type RouteResult struct {
+	Route        string
+	Destinations []config.Destination
+}
+
+func newRouter(consumerConf config.Consumer) (*router, error) {
+	r := &router{fallback: consumerConf.Endpoints()}
+	for _, rc := range consumerConf.Routes {
+		if rc.Name == "" {
+			return nil, errors.New("route name is required")
+		}
+		if len(rc.Tags) == 0 && rc.Keys == "" && rc.SQL == "" {
+			return nil, errors.Errorf("route %s requires tags, keys or sql", rc.Name)
+		}
+
+		rt := route{
+			name: rc.Name,
+			keys: rc.Keys,
+			endpoint: config.Destination{
+				Name:        rc.Name,
+				CallbackURL: rc.CallbackURL,
+				Policy:      config.DeliveryAll,
+				HTTP:        rc.HTTP,
+				GRPC:        rc.GRPC,
+				Transform:   rc.Transform,
+			},
+		}
+		if len(rc.Tags) > 0 {
+			rt.tags = make(map[string]bool, len(rc.Tags))
+			for _, tag := range rc.Tags {
+				rt.tags[strings.TrimSpace(tag)] = true
+			}
+		}
+		if rc.Keys != "" {
+			if _, err := path.Match(rc.Keys, ""); err != nil {
+				return nil, errors.Wrapf(err, "route %s keys %q", rc.Name, rc.Keys)
+			}
+		}
+		if rc.SQL != "" {
+			expr, err := filter.Parse(rc.SQL)
+			if err != nil {
+				return nil, errors.Wrapf(err, "route %s invalid sql %q", rc.Name, rc.SQL)
+			}
+			rt.expr = expr
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r, nil
+}
+
+// match 返回第一条匹配的路由, 都不匹配时返回默认回调目标.
+func (r *router) match(tags string, keys []string, props map[string]string) RouteResult {
+	for _, rt := range r.routes {
+		if rt.match(tags, keys, props) {
+			return RouteResult{Route: rt.name, Destinations: []config.Destination{rt.endpoint}}
+		}
+	}
+	return RouteResult{Destinations: r.fallback}
+}
+
+func (r *router) route(msg *primitive.MessageExt) RouteResult {
+	if len(r.routes) == 0 {
+		return RouteResult{Destinations: r.fallback}
+	}
+	return r.match(msg.GetTags(), strings.Fields(msg.GetProperty(propertyKeys)), msg.GetProperties())
+}
+
+// endpoints 返回默认与所有路由的回调目标.
+func (r *router) endpoints() []config.Destination {
+	endpoints := append([]config.Destination(nil), r.fallback...)
+	for _, rt := range r.routes {
+		endpoints = append(endpoints, rt.endpoint)
+	}
+	return endpoints
+}
+
+func (rt route) match(tags string, keys []string, props map[string]string) bool {
+	if rt.tags != nil && !rt.tags[tags] {
+		return false
+	}
+	if rt.keys != "" {
+		matched := false
+		for _, key := range keys {
+			if ok, _ := path.Match(rt.keys, key); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return rt.expr == nil || rt.expr.Match(props)
+}
+
+// Route 返回样例消息在消费组中匹配的路由, 不发送消息.
+func (a *Admin) Route(instance, group, tags string, keys []string, props map[string]string) (*RouteResult, error) {
+	for _, c := range a.conf.RocketMQ.Consumers {
+		if c.GroupID != group || getInstance(c.Instance) != getInstance(instance) {
+			continue
+		}
+		r, err := newRouter(c)
+		if err != nil {
+			return nil, err
+		}
+		result := r.match(tags, keys, props)
+		return &result, nil
+	}
+	return nil, errors.Errorf("consumer groupID(%s) not configured on instance %s", group, getInstance(instance))
+}
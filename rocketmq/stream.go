@@ -0,0 +1,385 @@
+package rocketmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/apache/rocketmq-client-go/v2"
+	cm "github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/external/log"
+	"github.com/linhoi/mq/internal/config"
+	mq "github.com/linhoi/mq/protobuf"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	defaultVisibilityTimeout = 30 * time.Second
+	maxVisibilityTimeout     = 12 * time.Hour
+	defaultStreamInflight    = 32
+	maxStreamInflight        = 1024
+)
+
+// broker 默认延迟级别对应的时长, 下标为级别减一.
+var delayLevels = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+	6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+	20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+}
+
+var (
+	ErrReceiptNotFound = errors.New("receipt not found, message acked or redelivered after visibility timeout")
+	ErrGroupConflict   = errors.New("consumer group subscribed with a different topic or selector")
+	ErrInvalidStream   = errors.New("invalid stream subscription")
+	ErrInstanceUnknown = errors.New("instance not found")
+	errStreamClosed    = errors.New("consumer group stream closed")
+)
+
+// StreamSubscription 客户端订阅参数.
+type StreamSubscription struct {
+	Instance          string
+	Group             string
+	Target            config.Target
+	MaxInflight       int
+	VisibilityTimeout time.Duration
+}
+
+// Streams 客户端主动订阅的消费组. 每个消费组在第一个连接订阅时启动 push consumer,
+// 最后一个连接断开时关闭. 消息由空闲的连接竞争获取, 实现连接间的负载均衡;
+// 未在可见性超时内确认, 或连接断开时未确认的消息重新投递给其他连接.
+type Streams struct {
+	consumer *Consumer // 回调消费的消费组与实例配置.
+
+	mu     sync.Mutex
+	closed bool
+	groups map[string]*streamGroup
+	leases map[string]*lease
+}
+
+type streamGroup struct {
+	key      string
+	target   config.Target
+	consumer rocketmq.PushConsumer
+	streams  int
+	pending  chan *delivery
+	closed   chan struct{}
+	started  chan struct{} // push consumer 启动完成后关闭, err 为启动失败的原因.
+	err      error
+}
+
+// delivery 一条等待客户端确认的消息, push consumer 的回调阻塞到 done 返回结果.
+type delivery struct {
+	msg  *primitive.MessageExt
+	done chan time.Duration // 0 表示已确认, 否则为重新消费的延迟.
+}
+
+type stream struct {
+	group  *streamGroup
+	sem    chan struct{}
+	leases map[string]*lease
+}
+
+// lease 投递给某个连接的消息, 超时或连接断开时重新投递.
+type lease struct {
+	receipt  string
+	delivery *delivery
+	stream   *stream
+	timer    *time.Timer
+}
+
+func NewStreams(consumer *Consumer) (*Streams, func()) {
+	s := &Streams{consumer: consumer, groups: make(map[string]*streamGroup), leases: make(map[string]*lease)}
+	return s, s.Shutdown
+}
+
+// Subscribe 持续把消费组的消息交给 send, 直到 ctx 结束或 send 失败.
+func (s *Streams) Subscribe(ctx context.Context, sub StreamSubscription, send func(receipt string, msg *mq.Message) error) error {
+	if sub.MaxInflight <= 0 {
+		sub.MaxInflight = defaultStreamInflight
+	}
+	if sub.MaxInflight > maxStreamInflight {
+		sub.MaxInflight = maxStreamInflight
+	}
+	if sub.VisibilityTimeout <= 0 {
+		sub.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if sub.VisibilityTimeout > maxVisibilityTimeout {
+		sub.VisibilityTimeout = maxVisibilityTimeout
+	}
+
+	g, err := s.join(sub)
+	if err != nil {
+		return err
+	}
+	st := &stream{group: g, sem: make(chan struct{}, sub.MaxInflight), leases: make(map[string]*lease)}
+	defer s.leave(st)
+
+	log.S(ctx).Infow("stream subscribed", "groupID", sub.Group, "topic", sub.Target.Topic)
+	for {
+		select {
+		case st.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		case <-g.closed:
+			return errStreamClosed
+		}
+
+		select {
+		case d := <-g.pending:
+			receipt := s.lease(st, d, sub.VisibilityTimeout)
+			if err := send(receipt, grpcMessage(d.msg)); err != nil {
+				_ = s.settle(receipt, -1)
+				return err
+			}
+		case <-ctx.Done():
+			<-st.sem
+			return nil
+		case <-g.closed:
+			return errStreamClosed
+		}
+	}
+}
+
+// Ack 确认消息已处理.
+func (s *Streams) Ack(receipt string) error {
+	return s.settle(receipt, 0)
+}
+
+// Nack 消息处理失败, delay 为0时立即重新投递, 否则由 broker 延迟后重新投递, 延迟取不小于 delay 的延迟级别.
+func (s *Streams) Nack(receipt string, delay time.Duration) error {
+	if delay <= 0 {
+		return s.settle(receipt, -1)
+	}
+	return s.settle(receipt, delay)
+}
+
+// Shutdown 关闭所有消费组, 未确认的消息由 broker 重新投递.
+func (s *Streams) Shutdown() {
+	s.mu.Lock()
+	s.closed = true
+	groups := s.groups
+	s.groups = make(map[string]*streamGroup)
+	s.mu.Unlock()
+
+	for _, g := range groups {
+		g.close()
+	}
+}
+
+func (s *Streams) join(sub StreamSubscription) (*streamGroup, error) {
+	if sub.Group == "" || sub.Target.Topic == "" {
+		return nil, errors.Wrap(ErrInvalidStream, "group and topic are required")
+	}
+	if err := validateTarget(sub.Target); err != nil {
+		return nil, errors.Wrap(ErrInvalidStream, err.Error())
+	}
+	if c, ok := s.consumer.configured(sub.Instance, sub.Group); ok {
+		return nil, errors.Wrapf(ErrGroupConflict, "consumer groupID(%s) is consumed by callback %s", sub.Group, c.CallbackURL)
+	}
+
+	key := groupKey(sub.Instance, sub.Group)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errStreamClosed
+	}
+	g, ok := s.groups[key]
+	if ok && !reflect.DeepEqual(g.target, sub.Target) {
+		s.mu.Unlock()
+		return nil, errors.Wrapf(ErrGroupConflict, "consumer groupID(%s) subscribed %s %q", sub.Group, g.target.Topic, g.target.Expression())
+	}
+	if !ok {
+		g = &streamGroup{
+			key:     key,
+			target:  sub.Target,
+			pending: make(chan *delivery),
+			closed:  make(chan struct{}),
+			started: make(chan struct{}),
+		}
+		s.groups[key] = g
+	}
+	g.streams++
+	s.mu.Unlock()
+
+	// 启动 push consumer 需要访问 name server 与 broker, 不持有锁, 同一消费组的其他连接等待启动完成.
+	if !ok {
+		g.consumer, g.err = s.startConsumer(sub, g)
+		close(g.started)
+	}
+	<-g.started
+	if g.err != nil {
+		s.mu.Lock()
+		g.streams--
+		if s.groups[key] == g {
+			delete(s.groups, key)
+		}
+		s.mu.Unlock()
+		return nil, g.err
+	}
+	return g, nil
+}
+
+func (s *Streams) startConsumer(sub StreamSubscription, g *streamGroup) (rocketmq.PushConsumer, error) {
+	ins, ok := s.consumer.instance(getInstance(sub.Instance))
+	if !ok {
+		return nil, errors.Wrap(ErrInstanceUnknown, getInstance(sub.Instance))
+	}
+
+	consumer, err := rocketmq.NewPushConsumer(
+		cm.WithGroupName(sub.Group),
+		cm.WithNameServerDomain(ins.NameServer),
+		cm.WithCredentials(primitive.Credentials{
+			AccessKey: ins.Credentials.AccessKey,
+			SecretKey: ins.Credentials.SecretKey,
+		}),
+		cm.WithConsumeMessageBatchMaxSize(1),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = consumer.Subscribe(sub.Target.Topic, selector(sub.Target), func(ctx context.Context, msgs ...*primitive.MessageExt) (cm.ConsumeResult, error) {
+		return g.handle(ctx, msgs...)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "subscribe groupID(%s)", sub.Group)
+	}
+	if err = consumer.Start(); err != nil {
+		_ = consumer.Shutdown()
+		return nil, errors.Wrapf(err, "start consumer groupID(%s)", sub.Group)
+	}
+
+	log.S(context.Background()).Infow("stream consumer started", "groupID", sub.Group, "topic", sub.Target.Topic)
+	return consumer, nil
+}
+
+func (s *Streams) leave(st *stream) {
+	s.mu.Lock()
+	leases := make([]string, 0, len(st.leases))
+	for receipt := range st.leases {
+		leases = append(leases, receipt)
+	}
+	s.mu.Unlock()
+
+	// 连接断开时未确认的消息立即重新投递.
+	for _, receipt := range leases {
+		_ = s.settle(receipt, -1)
+	}
+
+	s.mu.Lock()
+	g := st.group
+	g.streams--
+	last := g.streams == 0 && s.groups[g.key] == g
+	if last {
+		delete(s.groups, g.key)
+	}
+	s.mu.Unlock()
+
+	if last {
+		g.close()
+	}
+}
+
+func (s *Streams) lease(st *stream, d *delivery, timeout time.Duration) string {
+	l := &lease{receipt: newReceipt(), delivery: d, stream: st}
+
+	s.mu.Lock()
+	s.leases[l.receipt] = l
+	st.leases[l.receipt] = l
+	l.timer = time.AfterFunc(timeout, func() {
+		_ = s.settle(l.receipt, -1)
+	})
+	s.mu.Unlock()
+
+	return l.receipt
+}
+
+// settle 结束一次投递, result 为 -1 时重新投递给任一连接, 否则作为消费结果返回给 push consumer.
+func (s *Streams) settle(receipt string, result time.Duration) error {
+	s.mu.Lock()
+	l, ok := s.leases[receipt]
+	if ok {
+		delete(s.leases, receipt)
+		delete(l.stream.leases, receipt)
+		l.timer.Stop()
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrReceiptNotFound
+	}
+	<-l.stream.sem
+
+	if result < 0 {
+		go l.stream.group.requeue(l.delivery)
+		return nil
+	}
+	l.delivery.done <- result
+	return nil
+}
+
+// handle push consumer 的回调, 等待某个连接确认消息.
+func (g *streamGroup) handle(ctx context.Context, msgs ...*primitive.MessageExt) (cm.ConsumeResult, error) {
+	var delay time.Duration
+	for _, msg := range msgs {
+		d := &delivery{msg: msg, done: make(chan time.Duration, 1)}
+		g.requeue(d)
+
+		select {
+		case result := <-d.done:
+			if result > delay {
+				delay = result
+			}
+		case <-g.closed:
+			return cm.ConsumeRetryLater, nil
+		}
+	}
+
+	if delay == 0 {
+		return cm.ConsumeSuccess, nil
+	}
+	if concurrentCtx, ok := primitive.GetConcurrentlyCtx(ctx); ok {
+		concurrentCtx.DelayLevelWhenNextConsume = delayLevel(delay)
+	}
+	return cm.ConsumeRetryLater, nil
+}
+
+// requeue 等待空闲的连接获取消息, 消费组关闭时消息由 broker 重新投递.
+func (g *streamGroup) requeue(d *delivery) {
+	select {
+	case g.pending <- d:
+	case <-g.closed:
+	}
+}
+
+func (g *streamGroup) close() {
+	<-g.started
+	close(g.closed)
+	if g.err != nil {
+		return
+	}
+	if err := g.consumer.Shutdown(); err != nil {
+		log.S(context.Background()).Warnw("stream consumer shutdown", "key", g.key, "err", err)
+	}
+	log.S(context.Background()).Infow("stream consumer stopped", "key", g.key)
+}
+
+// delayLevel 返回不小于 delay 的最小延迟级别.
+func delayLevel(delay time.Duration) int {
+	for i, d := range delayLevels {
+		if d >= delay {
+			return i + minDelayLevel
+		}
+	}
+	return maxDelayLevel
+}
+
+func newReceipt() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,284 @@
+package rocketmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/linhoi/mq/internal/config"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// successProfiles 内置规则的默认状态码, 配置的 status 与 outcomes 在此基础上覆盖.
+var successProfiles = map[string]config.Success{
+	config.SuccessCode:   {},
+	config.SuccessStatus: {Status: []string{"2xx"}},
+	config.SuccessREST: {
+		Status: []string{"2xx"},
+		Outcomes: map[string]string{
+			// 认证失败与地址不存在通常是回调方配置或 token 轮换的问题, 重试而不是丢弃消息.
+			"401": OutcomeRetry,
+			"403": OutcomeRetry,
+			"404": OutcomeRetry,
+			"408": OutcomeRetry,
+			"429": OutcomeBackoff,
+			"503": OutcomeBackoff,
+			"4xx": OutcomeDiscard,
+			"5xx": OutcomeRetry,
+		},
+	},
+}
+
+type statusRange struct {
+	min, max int
+}
+
+func (r statusRange) contains(status int) bool {
+	return status >= r.min && status <= r.max
+}
+
+type statusOutcome struct {
+	statusRange
+	outcome string
+}
+
+// successRule 解析后的回调成功判断规则.
+type successRule struct {
+	profile  string
+	status   []statusRange // 为空时不判断状态码.
+	outcomes []statusOutcome
+	path     []string
+	value    string
+}
+
+func newSuccessRule(conf config.Success) (*successRule, error) {
+	profile := conf.Profile
+	if profile == "" {
+		profile = config.SuccessCode
+	}
+	defaults, ok := successProfiles[profile]
+	if !ok {
+		return nil, errors.Errorf("unknown success profile %s, want %s, %s or %s",
+			conf.Profile, config.SuccessCode, config.SuccessStatus, config.SuccessREST)
+	}
+
+	rule := &successRule{profile: profile, value: conf.Value}
+
+	status := defaults.Status
+	if len(conf.Status) > 0 {
+		status = conf.Status
+	}
+	for _, s := range status {
+		r, err := parseStatus(s)
+		if err != nil {
+			return nil, err
+		}
+		rule.status = append(rule.status, r)
+	}
+
+	outcomes := make(map[string]string, len(defaults.Outcomes)+len(conf.Outcomes))
+	for s, outcome := range defaults.Outcomes {
+		outcomes[s] = outcome
+	}
+	for s, outcome := range conf.Outcomes {
+		outcomes[s] = outcome
+	}
+	for s, outcome := range outcomes {
+		switch outcome {
+		case OutcomeSuccess, OutcomeRetry, OutcomeBackoff, OutcomeDiscard, OutcomeDeadLetter:
+		default:
+			return nil, errors.Errorf("status %s outcome %q, want %s, %s, %s, %s or %s",
+				s, outcome, OutcomeSuccess, OutcomeRetry, OutcomeBackoff, OutcomeDiscard, OutcomeDeadLetter)
+		}
+		r, err := parseStatus(s)
+		if err != nil {
+			return nil, err
+		}
+		rule.outcomes = append(rule.outcomes, statusOutcome{statusRange: r, outcome: outcome})
+	}
+
+	if conf.JSONPath != "" {
+		rule.path = strings.Split(strings.TrimPrefix(conf.JSONPath, "$."), ".")
+	} else if conf.Value != "" {
+		return nil, errors.New("success value requires jsonPath")
+	}
+	return rule, nil
+}
+
+// prepare 解析回调目标的成功判断规则, 消费组创建时调用, 回调时不再重复解析.
+func (c *Callback) prepare(consumerConf config.Consumer) error {
+	rule, err := newSuccessRule(consumerConf.HTTP.Success)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.rules[ruleKey(consumerConf)] = rule
+	c.mu.Unlock()
+	return nil
+}
+
+// successRule 返回 prepare 解析的规则, 未经过消费组的回调(如死信重放)在第一次回调时解析.
+func (c *Callback) successRule(consumerConf config.Consumer) (*successRule, error) {
+	c.mu.Lock()
+	rule, ok := c.rules[ruleKey(consumerConf)]
+	c.mu.Unlock()
+	if ok {
+		return rule, nil
+	}
+	if err := c.prepare(consumerConf); err != nil {
+		return nil, err
+	}
+	return c.successRule(consumerConf)
+}
+
+// ruleKey 同一消费组的多个目标可以使用相同的地址与不同的成功判断规则, key 中包含规则配置.
+func ruleKey(consumerConf config.Consumer) string {
+	success, _ := json.Marshal(consumerConf.HTTP.Success)
+	return groupKey(consumerConf.Instance, consumerConf.GroupID) + "@" + consumerConf.CallbackURL + "#" + string(success)
+}
+
+// parseStatus 解析 200, 2xx 或 200-204 形式的状态码.
+func parseStatus(s string) (statusRange, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		base := int(s[0]-'0') * 100
+		return statusRange{min: base, max: base + 99}, nil
+	}
+
+	lo, hi := s, s
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		lo, hi = s[:i], s[i+1:]
+	}
+	min, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	max, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || min < 100 || max > 599 || min > max {
+		return statusRange{}, errors.Errorf("invalid http status %q, want 200, 2xx or 200-204", s)
+	}
+	return statusRange{min: min, max: max}, nil
+}
+
+// evaluate 按状态码与响应体判断回调结果. 判断为成功时返回的响应中仍可以包含批量回调每条消息的结果.
+func (r *successRule) evaluate(status int, header http.Header, body []byte) (*CallbackResponse, error) {
+	if outcome, ok := r.outcome(status); ok {
+		if outcome != OutcomeSuccess {
+			return nil, r.statusError(outcome, status, header, body)
+		}
+	} else if !r.statusOK(status) {
+		return nil, errors.Errorf("callback status %d: %s", status, abbreviate(body))
+	}
+
+	resp := &CallbackResponse{}
+	switch {
+	case r.path != nil:
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, errors.Wrapf(err, "callback status %d", status)
+		}
+		got, ok := lookupJSON(v, r.path)
+		if !ok || got != r.value {
+			return nil, errors.Errorf("callback %s = %q, want %q", strings.Join(r.path, "."), got, r.value)
+		}
+		r.decode(body, resp)
+
+	case r.profile == config.SuccessCode:
+		if err := json.Unmarshal(body, resp); err != nil {
+			return nil, errors.Wrapf(err, "callback status %d", status)
+		}
+
+	default:
+		r.decode(body, resp)
+	}
+	return resp, nil
+}
+
+// decode 尽量解析响应体中的 outcome 与批量结果, code 只在 code 规则下判断.
+func (r *successRule) decode(body []byte, resp *CallbackResponse) {
+	if err := json.Unmarshal(body, resp); err != nil {
+		*resp = CallbackResponse{}
+	}
+	resp.Code = 0
+}
+
+func (r *successRule) statusOK(status int) bool {
+	if len(r.status) == 0 {
+		return true
+	}
+	for _, s := range r.status {
+		if s.contains(status) {
+			return true
+		}
+	}
+	return false
+}
+
+// outcome 返回匹配状态码的范围最小的结果.
+func (r *successRule) outcome(status int) (string, bool) {
+	var matched *statusOutcome
+	for i, o := range r.outcomes {
+		if o.contains(status) && (matched == nil || o.max-o.min < matched.max-matched.min) {
+			matched = &r.outcomes[i]
+		}
+	}
+	if matched == nil {
+		return "", false
+	}
+	return matched.outcome, true
+}
+
+func (r *successRule) statusError(outcome string, status int, header http.Header, body []byte) error {
+	reason := "status " + strconv.Itoa(status)
+	if len(body) > 0 {
+		reason += ": " + abbreviate(body)
+	}
+	if outcome == OutcomeBackoff {
+		return newOutcome(OutcomeRetry, retryAfter(header), 0, reason)
+	}
+	return newOutcome(outcome, 0, 0, reason)
+}
+
+// retryAfter 解析秒数或 HTTP 日期形式的 Retry-After, 没有时按消费组的重试策略.
+func retryAfter(header http.Header) time.Duration {
+	v := strings.TrimSpace(header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func lookupJSON(v interface{}, path []string) (string, bool) {
+	v, ok := lookupPath(v, path)
+	if !ok {
+		return "", false
+	}
+
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "null", true
+	default:
+		b, _ := json.Marshal(value)
+		return string(b), true
+	}
+}
+
+func abbreviate(body []byte) string {
+	const max = 256
+	body = bytes.TrimSpace(body)
+	if len(body) > max {
+		return string(body[:max]) + "..."
+	}
+	return string(body)
+}
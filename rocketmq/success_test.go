@@ -0,0 +1,50 @@
+package rocketmq
+
+import (
+	"github.com/linhoi/mq/internal/config"
+	"net/http"
+	"testing"
+)
+
+func TestSuccessRuleSharedURL(t *testing.T) {
+	consumerConf := config.Consumer{
+		GroupID: "GID_test",
+		Destinations: []config.Destination{
+			{Name: "code", CallbackURL: "http://callback/hook"},
+			{Name: "rest", CallbackURL: "http://callback/hook", HTTP: config.HTTP{Success: config.Success{Profile: config.SuccessREST}}},
+		},
+	}
+
+	c := NewCallback()
+	for _, dest := range consumerConf.Destinations {
+		if err := c.prepare(destinationConf(consumerConf, dest)); err != nil {
+			t.Fatalf("prepare(%s) error = %v", dest.Name, err)
+		}
+	}
+
+	tests := []struct {
+		dest    config.Destination
+		status  int
+		body    string
+		success bool
+	}{
+		{dest: consumerConf.Destinations[0], status: http.StatusOK, body: `{"code":0}`, success: true},
+		{dest: consumerConf.Destinations[0], status: http.StatusOK, body: `{"code":1}`, success: false},
+		{dest: consumerConf.Destinations[1], status: http.StatusOK, body: `{"code":1}`, success: true},
+		{dest: consumerConf.Destinations[1], status: http.StatusNotFound, body: ``, success: false},
+	}
+
+	for _, tt := range tests {
+		rule, err := c.successRule(destinationConf(consumerConf, tt.dest))
+		if err != nil {
+			t.Fatalf("successRule(%s) error = %v", tt.dest.Name, err)
+		}
+		resp, err := rule.evaluate(tt.status, http.Header{}, []byte(tt.body))
+		if err == nil {
+			err = resp.err()
+		}
+		if got := err == nil; got != tt.success {
+			t.Errorf("%s: evaluate(%d, %s) success = %v, want %v, err = %v", tt.dest.Name, tt.status, tt.body, got, tt.success, err)
+		}
+	}
+}
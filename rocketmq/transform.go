@@ -0,0 +1,330 @@
+package rocketmq
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/linhoi/mq/internal/config"
+	mq "github.com/linhoi/mq/protobuf"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+	"strings"
+)
+
+// transformed 转换后的回调请求, bodies 与消息一一对应, 未配置消息体转换时为空.
+type transformed struct {
+	bodies  []json.RawMessage
+	headers map[string]string
+	query   map[string]string
+}
+
+// transformData 转换模板的数据.
+type transformData struct {
+	headerData
+	BornTimestamp int64
+	Body          interface{}
+}
+
+// transform 按回调目标的转换配置转换消息, 未配置时返回 nil. errs 为每条消息的转换结果, 全部成功时为 nil,
+// 转换失败的消息直接进入死信, 不影响同一批的其他消息.
+func (c *Callback) transform(consumerConf config.Consumer, msgs []*primitive.MessageExt) (t *transformed, errs []error) {
+	conf := consumerConf.Transform
+	if len(conf.Fields) == 0 && conf.Template == "" && len(conf.Headers) == 0 && len(conf.Query) == 0 {
+		return nil, nil
+	}
+
+	t = &transformed{}
+	failed := func(i int, err error) {
+		if errs == nil {
+			errs = make([]error, len(msgs))
+		}
+		errs[i] = transformFailed(msgs[i], err)
+	}
+
+	count := len(msgs)
+	if len(conf.Fields) > 0 || conf.Template != "" {
+		t.bodies = make([]json.RawMessage, len(msgs))
+		for i, msg := range msgs {
+			body, err := c.transformBody(consumerConf, msg)
+			if err != nil {
+				failed(i, err)
+				count--
+				continue
+			}
+			t.bodies[i] = body
+		}
+	}
+
+	// 请求头与 query 参数使用第一条转换成功的消息, 渲染失败时只有该消息进入死信.
+	for i, msg := range msgs {
+		if errs != nil && errs[i] != nil {
+			continue
+		}
+		data := newTransformData(consumerConf.GroupID, msg, count)
+		headers, err := c.renderAll(conf.Headers, data)
+		if err != nil {
+			failed(i, err)
+			count--
+			continue
+		}
+		query, err := c.renderAll(conf.Query, data)
+		if err != nil {
+			failed(i, err)
+			count--
+			continue
+		}
+		t.headers, t.query = headers, query
+		break
+	}
+	return t, errs
+}
+
+// pending 返回转换成功需要回调的消息与其在 msgs 中的下标, 消息体只保留这些消息的.
+func (t *transformed) pending(msgs []*primitive.MessageExt, errs []error) ([]*primitive.MessageExt, []int) {
+	todo := make([]*primitive.MessageExt, 0, len(msgs))
+	index := make([]int, 0, len(msgs))
+	var bodies []json.RawMessage
+	for i, msg := range msgs {
+		if errs != nil && errs[i] != nil {
+			continue
+		}
+		todo = append(todo, msg)
+		index = append(index, i)
+		if t != nil && len(t.bodies) > 0 {
+			bodies = append(bodies, t.bodies[i])
+		}
+	}
+	if t != nil && len(t.bodies) > 0 {
+		t.bodies = bodies
+	}
+	return todo, index
+}
+
+func (c *Callback) transformBody(consumerConf config.Consumer, msg *primitive.MessageExt) (json.RawMessage, error) {
+	conf := consumerConf.Transform
+	if conf.Template != "" {
+		rendered, err := c.render(conf.Template, newTransformData(consumerConf.GroupID, msg, 1))
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid([]byte(rendered)) {
+			return nil, errors.Errorf("template output is not valid JSON: %s", abbreviate([]byte(rendered)))
+		}
+		return json.RawMessage(rendered), nil
+	}
+
+	source, err := transformSource(msg)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{})
+	for _, f := range conf.Fields {
+		path, err := parseJSONPath(f.From)
+		if err != nil {
+			return nil, err
+		}
+		value, _ := lookupPath(source, path)
+		if err = setPath(out, strings.Split(f.To, "."), value); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(out)
+	return b, errors.WithStack(err)
+}
+
+func (c *Callback) renderAll(templates map[string]string, data transformData) (map[string]string, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	rendered := make(map[string]string, len(templates))
+	for name, text := range templates {
+		value, err := c.render(text, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered[name] = value
+	}
+	return rendered, nil
+}
+
+// httpBody 返回转换后的 http 请求体, 批量回调时为数组.
+func (t *transformed) httpBody(batch bool) []byte {
+	if !batch {
+		return t.bodies[0]
+	}
+	b, _ := json.Marshal(t.bodies)
+	return b
+}
+
+// grpc 把转换结果应用到 gRPC 回调的消息与 metadata.
+func (t *transformed) grpc(ctx context.Context, msgs []*mq.Message) context.Context {
+	if t == nil {
+		return ctx
+	}
+	for i, body := range t.bodies {
+		msgs[i].Body = string(body)
+	}
+	if len(t.headers) == 0 {
+		return ctx
+	}
+	kv := make([]string, 0, len(t.headers)*2)
+	for name, value := range t.headers {
+		kv = append(kv, strings.ToLower(name), value)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+func newTransformData(group string, msg *primitive.MessageExt, count int) transformData {
+	data := transformData{
+		headerData:    newHeaderData(group, []*primitive.MessageExt{msg}),
+		BornTimestamp: msg.BornTimestamp,
+		Body:          decodeBody(msg.Body),
+	}
+	data.Count = count
+	return data
+}
+
+// transformSource 返回 JSONPath 的源文档, 字段同 http 回调的消息.
+func transformSource(msg *primitive.MessageExt) (interface{}, error) {
+	b, err := json.Marshal(newPayloadMessage(msg))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var source map[string]interface{}
+	if err = json.Unmarshal(b, &source); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	source["body"] = decodeBody(msg.Body)
+	return source, nil
+}
+
+// decodeBody 返回 JSON 解析后的消息体, 不是 JSON 时为字符串.
+func decodeBody(body []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	return v
+}
+
+// parseJSONPath 解析 $.a.b[0].c 形式的路径.
+func parseJSONPath(expr string) ([]string, error) {
+	s := strings.TrimSpace(expr)
+	if s != "$" && !strings.HasPrefix(s, "$.") && !strings.HasPrefix(s, "$[") {
+		return nil, errors.Errorf("jsonPath %q must start with $", expr)
+	}
+	s = strings.TrimPrefix(s, "$")
+
+	var path []string
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, errors.Errorf("jsonPath %q has an empty field", expr)
+			}
+			path = append(path, s[:end])
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errors.Errorf("jsonPath %q has an unclosed [", expr)
+			}
+			index := strings.Trim(s[1:end], `'"`)
+			if index == "" {
+				return nil, errors.Errorf("jsonPath %q has an empty index", expr)
+			}
+			path = append(path, index)
+			s = s[end+1:]
+		default:
+			return nil, errors.Errorf("jsonPath %q: unexpected %q", expr, s[0])
+		}
+	}
+	return path, nil
+}
+
+func lookupPath(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func setPath(out map[string]interface{}, path []string, value interface{}) error {
+	for i, key := range path {
+		if key == "" {
+			return errors.Errorf("field %q has an empty segment", strings.Join(path, "."))
+		}
+		if i == len(path)-1 {
+			out[key] = value
+			return nil
+		}
+		child, ok := out[key].(map[string]interface{})
+		if !ok {
+			if _, exists := out[key]; exists {
+				return errors.Errorf("field %q conflicts with %s", strings.Join(path, "."), key)
+			}
+			child = make(map[string]interface{})
+			out[key] = child
+		}
+		out = child
+	}
+	return nil
+}
+
+func transformFailed(msg *primitive.MessageExt, err error) error {
+	return &OutcomeError{Outcome: OutcomeDeadLetter, Reason: "transform message " + msg.MsgId + ": " + err.Error()}
+}
+
+func validateTransform(conf config.Transform) error {
+	if len(conf.Fields) > 0 && conf.Template != "" {
+		return errors.New("fields and template can not be used together")
+	}
+
+	out := make(map[string]interface{})
+	for _, f := range conf.Fields {
+		if _, err := parseJSONPath(f.From); err != nil {
+			return err
+		}
+		if f.To == "" {
+			return errors.Errorf("field from %s requires to", f.From)
+		}
+		if err := setPath(out, strings.Split(f.To, "."), nil); err != nil {
+			return err
+		}
+	}
+
+	if conf.Template != "" {
+		if _, err := parseTemplate(conf.Template); err != nil {
+			return err
+		}
+	}
+	for _, templates := range []map[string]string{conf.Headers, conf.Query} {
+		for name, text := range templates {
+			if _, err := parseTemplate(text); err != nil {
+				return errors.Wrapf(err, "%s", name)
+			}
+		}
+	}
+	return nil
+}